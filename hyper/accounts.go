@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Every open account has an entry in the registry, keyed by
+// compositeKey(accountsKey, id) with the account ID as the value. Closing an
+// account removes its entry but keeps the account record, so its history
+// and the ledger's cash totals still add up.
+
+type CloseAccount struct {
+	ID         string `json:"id"`
+	TransferTo string `json:"transferTo"`
+}
+
+// AccountQuery filters the registry. MaxBalance of zero means no maximum.
+// Holds is a CUSIP the account must own or have listed tokens of, and Role a
+// role it must hold.
+type AccountQuery struct {
+	MinBalance Money  `json:"minBalance"`
+	MaxBalance Money  `json:"maxBalance"`
+	Holds      string `json:"holds"`
+	Role       string `json:"role"`
+	PageQuery
+}
+
+type AccountPage struct {
+	Accounts []Account `json:"accounts"`
+	Bookmark string    `json:"bookmark"`
+}
+
+func registerAccount(stub StateStub, id string) error {
+	err := stub.PutState(compositeKey(accountsKey, id), []byte(id))
+	if err != nil {
+		fmt.Println("Error registering account " + id)
+		return errors.New("Error registering account " + id)
+	}
+	return nil
+}
+
+// indexAccounts adds every open account to the registry, for accounts
+// created before the registry existed. Closed accounts are left out.
+func (t *SimpleChaincode) indexAccounts(stub StateStub, args []string) ([]byte, error) {
+	_, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := 0
+	err = scanPrefix(stub, accountPrefix, func(key string, value []byte) error {
+		var account Account
+		err := json.Unmarshal(value, &account)
+		if err != nil {
+			fmt.Println("Error unmarshalling account " + key)
+			return errors.New("Error unmarshalling account " + key)
+		}
+		if account.Closed != "" {
+			return nil
+		}
+		accounts++
+		return registerAccount(stub, account.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Registered %d accounts\n", accounts)
+	return nil, nil
+}
+
+// closeAccount closes an account for good. The account or the admin can
+// close it once it holds no tokens, bids, leases or deposits and issues no
+// live property. Any cash left goes to TransferTo.
+func (t *SimpleChaincode) closeAccount(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting close record")
+	}
+
+	var ca CloseAccount
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &ca)
+	if err != nil {
+		fmt.Println("Error Unmarshalling CloseAccount")
+		return nil, errors.New("Invalid close record")
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller.ID != ca.ID && !hasRole(caller, roleAdmin) {
+		return nil, errors.New("Only " + ca.ID + " or the admin can close account " + ca.ID)
+	}
+	adminBytes, _ := stub.GetState(adminKey)
+	if string(adminBytes) == ca.ID {
+		return nil, errors.New("Cannot close the deployment admin " + ca.ID)
+	}
+
+	account, err := GetCompany(ca.ID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if account.Closed != "" {
+		return nil, errors.New("Account " + ca.ID + " is already closed")
+	}
+	if len(account.Leases) > 0 || account.Escrow != 0 {
+		return nil, errors.New("Account " + ca.ID + " still has leases or deposits held")
+	}
+
+	err = scanPrefix(stub, ptyPrefix, func(key string, value []byte) error {
+		var cp PTY
+		err := json.Unmarshal(value, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return errors.New("Error unmarshalling " + key)
+		}
+		if cp.Issuer == ca.ID && !hasStatus(cp, statusDelisted, statusSold) {
+			return errors.New("Account " + ca.ID + " issues property " + cp.CUSIP + ", which is " + cp.Status)
+		}
+		for _, holder := range holdersOf(cp) {
+			if holder.InvestorID == ca.ID {
+				return errors.New("Account " + ca.ID + " still holds tokens of " + cp.CUSIP)
+			}
+		}
+		for _, bid := range cp.Bids {
+			if bid.InvestorID == ca.ID {
+				return errors.New("Account " + ca.ID + " still has a bid on " + cp.CUSIP)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if account.CashBalance != 0 {
+		if ca.TransferTo == "" || ca.TransferTo == ca.ID {
+			return nil, errors.New("Account " + ca.ID + " has " + account.CashBalance.String() + " left and needs another account to transfer it to")
+		}
+		to, err := GetCompany(ca.TransferTo, stub)
+		if err != nil || to.Closed != "" {
+			return nil, errors.New("Cannot transfer to account " + ca.TransferTo)
+		}
+		to.CashBalance += account.CashBalance
+		err = putCompany(stub, to)
+		if err != nil {
+			return nil, err
+		}
+		account.CashBalance = 0
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+	account.Closed = now
+	account.Roles = nil
+	err = putCompany(stub, account)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.DelState(compositeKey(accountsKey, account.ID))
+	if err != nil {
+		return nil, errors.New("Error removing account " + account.ID + " from the registry")
+	}
+
+	fmt.Println("Closed account " + account.ID)
+	return nil, nil
+}
+
+// GetAllAccounts pages through every open account in ID order.
+func GetAllAccounts(args string, stub StateStub) (AccountPage, error) {
+	var aq AccountQuery
+	if args != "" {
+		err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &aq)
+		if err != nil {
+			return AccountPage{}, errors.New("GetAllAccounts expects {\"limit\": ..., \"bookmark\": ...}")
+		}
+	}
+	return searchAccounts(stub, AccountQuery{PageQuery: PageQuery{Bookmark: aq.Bookmark, Limit: aq.Limit}})
+}
+
+// SearchAccounts pages through the open accounts in ID order, keeping those
+// that match every filter given. Accounts that are filtered out don't count
+// towards the page limit.
+func SearchAccounts(args string, stub StateStub) (AccountPage, error) {
+	var aq AccountQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &aq)
+	if err != nil {
+		return AccountPage{}, errors.New("SearchAccounts expects an account query record")
+	}
+	return searchAccounts(stub, aq)
+}
+
+func searchAccounts(stub StateStub, aq AccountQuery) (AccountPage, error) {
+	var page AccountPage
+
+	var held map[string]bool
+	if aq.Holds != "" {
+		cp, err := GetPTY(aq.Holds, stub)
+		if err != nil {
+			return page, err
+		}
+		held = map[string]bool{}
+		for _, holder := range holdersOf(cp) {
+			held[holder.InvestorID] = true
+		}
+	}
+
+	// Account IDs are not timestamps
+	aq.From = ""
+	aq.To = ""
+	bookmark, err := pageIndex(stub, compositeKey(accountsKey), aq.PageQuery, func(key string, value []byte) error {
+		account, err := GetCompany(string(value), stub)
+		if err != nil {
+			return err
+		}
+		if account.CashBalance < aq.MinBalance || (aq.MaxBalance > 0 && account.CashBalance > aq.MaxBalance) {
+			return errSkipEntry
+		}
+		if held != nil && !held[account.ID] {
+			return errSkipEntry
+		}
+		if aq.Role != "" && !holdsRole(account, aq.Role) {
+			return errSkipEntry
+		}
+		page.Accounts = append(page.Accounts, account)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+	page.Bookmark = bookmark
+	return page, nil
+}
+
+// holdsRole is whether account was granted role itself. Unlike hasRole,
+// admin doesn't stand in for every other role.
+func holdsRole(account Account, role string) bool {
+	for _, held := range account.Roles {
+		if held == role {
+			return true
+		}
+	}
+	return false
+}
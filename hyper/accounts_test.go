@@ -0,0 +1,134 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func accountIDs(page AccountPage) []string {
+	var ids []string
+	for _, account := range page.Accounts {
+		ids = append(ids, account.ID)
+	}
+	return ids
+}
+
+func TestCloseAccount(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':100}")
+	l.invoke("company3", "placeBid", "{'cusip':'"+cusip+"','invid':'company3','quantity':5,'limitPrice':9}")
+	lease := string(l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':500,'start':'0','end':'31536000000'}"))
+	l.invoke("company4", "acceptLease", "{'leaseId':'"+lease+"'}")
+	l.invoke("admin", "createAccount", "company5")
+
+	tests := []struct {
+		name    string
+		caller  string
+		payload string
+		reason  string
+	}{
+		{"issuer of a live property", "company1", "{'id':'company1','transferTo':'company3'}", "issues property"},
+		{"holds tokens", "company2", "{'id':'company2','transferTo':'company3'}", "holds tokens"},
+		{"has a bid", "company3", "{'id':'company3','transferTo':'company2'}", "has a bid"},
+		{"has a lease and deposit", "company4", "{'id':'company4','transferTo':'company3'}", "leases or deposits"},
+		{"deployment admin", "admin", "{'id':'admin','transferTo':'company3'}", "deployment admin"},
+		{"another account", "company2", "{'id':'company5','transferTo':'company2'}", "Only company5"},
+		{"cash with nowhere to go", "company5", "{'id':'company5'}", "transfer it to"},
+		{"cash to itself", "company5", "{'id':'company5','transferTo':'company5'}", "transfer it to"},
+		{"cash to a missing account", "company5", "{'id':'company5','transferTo':'nobody'}", "Cannot transfer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			err := l.invokeErr(tt.caller, "closeAccount", tt.payload)
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("refused with %q, want %q", err, tt.reason)
+			}
+		})
+	}
+	l.t = t
+
+	cash := l.cash("company3")
+	l.invoke("company5", "closeAccount", "{'id':'company5','transferTo':'company3'}")
+	if got := l.cash("company3") - cash; got != defaultCashBalance {
+		t.Errorf("company3 received %s, want %s", got, defaultCashBalance)
+	}
+	if closed := l.account("company5"); closed.Closed == "" || closed.CashBalance != 0 || len(closed.Roles) != 0 {
+		t.Errorf("closed account is %+v", closed)
+	}
+	var page AccountPage
+	l.queryJSON(&page, "GetAllAccounts")
+	if got := accountIDs(page); !reflect.DeepEqual(got, []string{"admin", "company1", "company2", "company3", "company4"}) {
+		t.Errorf("open accounts are %v", got)
+	}
+
+	// A closed account can't act, or be closed again
+	err := l.invokeErr("company5", "placeBid", "{'cusip':'"+cusip+"','invid':'company5','quantity':1,'limitPrice':1}")
+	if !strings.Contains(err.Error(), "closed") {
+		t.Errorf("closed account refused with %q", err)
+	}
+	l.invokeErr("admin", "closeAccount", "{'id':'company5'}")
+	l.invokeErr("company3", "closeAccount", "{'id':'company3','transferTo':'company5'}")
+	l.verify()
+}
+
+func TestSearchAccounts(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':50,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':10}")
+	l.invoke("company3", "placeBid", "{'cusip':'"+cusip+"','invid':'company3','quantity':5,'limitPrice':9}")
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"issuers", "{'role':'issuer'}", []string{"company1"}},
+		{"holders", "{'holds':'" + cusip + "'}", []string{"company1", "company2"}},
+		{"below the opening balance", "{'maxBalance':9999999}", []string{"company2"}},
+		{"above the opening balance", "{'minBalance':10000001}", []string{"company1"}},
+		{"every filter", "{'holds':'" + cusip + "','role':'investor','minBalance':10000000}", []string{"company1"}},
+		{"filtered accounts don't use up the page", "{'role':'renter','limit':1}", []string{"company4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			var page AccountPage
+			l.queryJSON(&page, "SearchAccounts", tt.query)
+			if got := accountIDs(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("found %v, want %v", got, tt.want)
+			}
+		})
+	}
+	l.t = t
+
+	var page AccountPage
+	l.queryJSON(&page, "GetAllAccounts", "{'limit':2}")
+	if got := accountIDs(page); !reflect.DeepEqual(got, []string{"admin", "company1"}) || page.Bookmark == "" {
+		t.Errorf("first page of accounts is %v", got)
+	}
+}
+
+func TestIndexAccounts(t *testing.T) {
+	l := newTestLedger(t)
+	l.setUp()
+	l.invoke("admin", "createAccount", "company5")
+	l.invoke("company5", "closeAccount", "{'id':'company5','transferTo':'company4'}")
+
+	// As if company2 and company3 were opened before the registry existed
+	l.stub.DelState(compositeKey(accountsKey, "company2"))
+	l.stub.DelState(compositeKey(accountsKey, "company3"))
+	l.invokeErr("company1", "indexAccounts")
+	l.invoke("admin", "indexAccounts")
+
+	var page AccountPage
+	l.queryJSON(&page, "GetAllAccounts")
+	if got := accountIDs(page); !reflect.DeepEqual(got, []string{"admin", "company1", "company2", "company3", "company4"}) {
+		t.Errorf("registered accounts are %v", got)
+	}
+	l.verify()
+}
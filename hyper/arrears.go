@@ -0,0 +1,333 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RentCharge is one month's rent billed on a lease by accrueRent. Charges
+// stay on the lease until they are paid in full.
+type RentCharge struct {
+	Due     string `json:"due"`
+	Rent    Money  `json:"rent"`
+	LateFee Money  `json:"lateFee"`
+	Paid    Money  `json:"paid"`
+}
+
+func (c RentCharge) owed() Money {
+	return c.Rent + c.LateFee - c.Paid
+}
+
+type SetLateFee struct {
+	CUSIP     string `json:"cusip"`
+	LateFee   Money  `json:"lateFee"`
+	GraceDays int    `json:"graceDays"`
+}
+
+type AccrueRent struct {
+	CUSIP string `json:"cusip"`
+}
+
+type ArrearsQuery struct {
+	CUSIP  string `json:"cusip"`
+	Tenant string `json:"tenant"`
+}
+
+// LeaseArrears is what one lease owes: unpaid rent plus late fees.
+type LeaseArrears struct {
+	LeaseID   string       `json:"leaseId"`
+	CUSIP     string       `json:"cusip"`
+	Tenant    string       `json:"tenant"`
+	Unit      string       `json:"unit"`
+	Status    string       `json:"status"`
+	Owed      Money        `json:"owed"`
+	LateFees  Money        `json:"lateFees"`
+	OldestDue string       `json:"oldestDue"`
+	Charges   []RentCharge `json:"charges"`
+}
+
+type ArrearsReport struct {
+	Total  Money          `json:"total"`
+	Leases []LeaseArrears `json:"leases"`
+}
+
+// setLateFee sets the flat fee added to a month's rent when it is still
+// unpaid GraceDays after it fell due. A zero fee turns late fees off.
+func (t *SimpleChaincode) setLateFee(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting late fee record")
+	}
+
+	var lf SetLateFee
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &lf)
+	if err != nil {
+		fmt.Println("Error Unmarshalling SetLateFee")
+		return nil, errors.New("Invalid late fee record")
+	}
+	if lf.LateFee < 0 || lf.GraceDays < 0 {
+		return nil, errors.New("Late fee and grace days can't be negative")
+	}
+
+	cp, err := GetPTY(lf.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	cp.LateFee = lf.LateFee
+	cp.GraceDays = lf.GraceDays
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// accrueRent bills every month that has fallen due on active leases and adds
+// late fees to rent that is overdue. With a CUSIP it covers that property and
+// can be run by its issuer; without one it covers every property and needs
+// the admin. Running it again in the same period changes nothing.
+func (t *SimpleChaincode) accrueRent(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting accrual record")
+	}
+
+	var ar AccrueRent
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &ar)
+	if err != nil {
+		fmt.Println("Error Unmarshalling AccrueRent")
+		return nil, errors.New("Invalid accrual record")
+	}
+
+	now, err := txTime(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var leaseIDs []string
+	if ar.CUSIP != "" {
+		cp, err := GetPTY(ar.CUSIP, stub)
+		if err != nil {
+			return nil, err
+		}
+		err = requirePropertyIssuer(stub, cp)
+		if err != nil {
+			return nil, err
+		}
+		for _, renter := range cp.Renters {
+			leaseIDs = append(leaseIDs, renter.LeaseID)
+		}
+	} else {
+		_, err = requireRole(stub, roleAdmin)
+		if err != nil {
+			return nil, err
+		}
+		err = scanPrefix(stub, leasePrefix, func(key string, value []byte) error {
+			var lease Lease
+			err := json.Unmarshal(value, &lease)
+			if err != nil {
+				return errors.New("Error unmarshalling lease " + key)
+			}
+			if lease.Status == leaseActive {
+				leaseIDs = append(leaseIDs, lease.LeaseID)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	properties := map[string]PTY{}
+	for _, leaseID := range leaseIDs {
+		lease, err := GetLease(leaseID, stub)
+		if err != nil {
+			return nil, err
+		}
+		cp, ok := properties[lease.CUSIP]
+		if !ok {
+			cp, err = GetPTY(lease.CUSIP, stub)
+			if err != nil {
+				return nil, err
+			}
+			properties[lease.CUSIP] = cp
+		}
+
+		changed, err := accrueLease(&lease, cp, now)
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			err = putLease(stub, lease)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	fmt.Println("Accrued rent on " + strconv.Itoa(len(leaseIDs)) + " leases")
+	return nil, nil
+}
+
+// accrueLease adds a charge for each month from the last one billed up to
+// now, stopping at the lease end, then adds the property's late fee to any
+// charge still unpaid past the grace period. Credit from payments made ahead
+// is used up first. It reports whether the lease changed.
+func accrueLease(lease *Lease, cp PTY, now time.Time) (bool, error) {
+	if lease.Status != leaseActive {
+		return false, nil
+	}
+	start, err := msToTime(lease.Start)
+	if err != nil {
+		return false, errors.New("Lease " + lease.LeaseID + " has an invalid start")
+	}
+	end, err := msToTime(lease.End)
+	if err != nil {
+		return false, errors.New("Lease " + lease.LeaseID + " has an invalid end")
+	}
+
+	// Month arithmetic is done in UTC so every peer agrees on the dates
+	start, end = start.UTC(), end.UTC()
+
+	changed := false
+	for {
+		// Count months from the start each time so a lease starting on the
+		// 31st doesn't drift to the 28th after February
+		due := start.AddDate(0, lease.PeriodsBilled, 0)
+		if due.After(now) || !due.Before(end) {
+			break
+		}
+
+		var charge RentCharge
+		charge.Due = strconv.FormatInt(due.UnixNano()/nanosPerMillisecond, 10)
+		charge.Rent = lease.MonthlyRent
+		if lease.Credit > 0 {
+			charge.Paid = lease.Credit
+			if charge.Paid > charge.Rent {
+				charge.Paid = charge.Rent
+			}
+			lease.Credit -= charge.Paid
+		}
+		if charge.owed() > 0 {
+			lease.Charges = append(lease.Charges, charge)
+		}
+		lease.PeriodsBilled++
+		changed = true
+	}
+
+	if cp.LateFee > 0 {
+		for i, charge := range lease.Charges {
+			if charge.LateFee > 0 {
+				continue
+			}
+			due, err := msToTime(charge.Due)
+			if err != nil {
+				return false, errors.New("Lease " + lease.LeaseID + " has an invalid charge date")
+			}
+			if now.After(due.UTC().AddDate(0, 0, cp.GraceDays)) {
+				lease.Charges[i].LateFee = cp.LateFee
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+// leaseOwed is everything outstanding on a lease, and the late fees charged
+// on the months still open.
+func leaseOwed(lease Lease) (Money, Money) {
+	var owed, fees Money
+	for _, charge := range lease.Charges {
+		owed += charge.owed()
+		fees += charge.LateFee
+	}
+	return owed, fees
+}
+
+// applyRentPayment pays off a lease's charges oldest first. A zero payment
+// means everything owed, or a month in advance when nothing is. What is left
+// over after the charges becomes credit against the next months, which only
+// active leases can take. Returns the amount the renter pays.
+func applyRentPayment(lease *Lease, payment Money) (Money, error) {
+	if payment < 0 {
+		return 0, errors.New("Rent payment can't be negative")
+	}
+	owed, _ := leaseOwed(*lease)
+	if payment == 0 {
+		payment = owed
+		if payment == 0 {
+			payment = lease.MonthlyRent
+		}
+	}
+	if lease.Status != leaseActive && payment > owed {
+		return 0, errors.New("Lease " + lease.LeaseID + " is " + lease.Status + " and only owes " + owed.String())
+	}
+
+	left := payment
+	var charges []RentCharge
+	for _, charge := range lease.Charges {
+		pay := charge.owed()
+		if left < pay {
+			pay = left
+		}
+		charge.Paid += pay
+		left -= pay
+		if charge.owed() > 0 {
+			charges = append(charges, charge)
+		}
+	}
+	lease.Charges = charges
+	lease.Credit += left
+	return payment, nil
+}
+
+// GetArrears lists the leases that owe rent, optionally for one property or
+// one tenant, with what each owes and since when.
+func GetArrears(args string, stub StateStub) (ArrearsReport, error) {
+	var report ArrearsReport
+	var aq ArrearsQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &aq)
+	if err != nil {
+		return report, errors.New("Invalid arrears query")
+	}
+
+	err = scanPrefix(stub, leasePrefix, func(key string, value []byte) error {
+		var lease Lease
+		err := json.Unmarshal(value, &lease)
+		if err != nil {
+			return errors.New("Error unmarshalling lease " + key)
+		}
+		if aq.CUSIP != "" && lease.CUSIP != aq.CUSIP {
+			return nil
+		}
+		if aq.Tenant != "" && lease.Tenant != aq.Tenant {
+			return nil
+		}
+		owed, fees := leaseOwed(lease)
+		if owed == 0 {
+			return nil
+		}
+
+		var arrears LeaseArrears
+		arrears.LeaseID = lease.LeaseID
+		arrears.CUSIP = lease.CUSIP
+		arrears.Tenant = lease.Tenant
+		arrears.Unit = lease.Unit
+		arrears.Status = lease.Status
+		arrears.Owed = owed
+		arrears.LateFees = fees
+		arrears.OldestDue = lease.Charges[0].Due
+		arrears.Charges = lease.Charges
+		report.Leases = append(report.Leases, arrears)
+		report.Total += owed
+		return nil
+	})
+	return report, err
+}
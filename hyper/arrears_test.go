@@ -0,0 +1,190 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func msOf(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/nanosPerMillisecond, 10)
+}
+
+func TestAccrueLease(t *testing.T) {
+	jan15 := time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		lease       Lease
+		cp          PTY
+		now         time.Time
+		wantChanged bool
+		wantBilled  int
+		wantCharges int
+		wantOwed    Money
+		wantFees    Money
+		wantCredit  Money
+	}{
+		{
+			name:        "bills each month that has fallen due",
+			lease:       Lease{Status: leaseActive, MonthlyRent: 10000, Start: msOf(jan15), End: msOf(jan15.AddDate(1, 0, 0))},
+			now:         time.Date(2024, time.March, 20, 0, 0, 0, 0, time.UTC),
+			wantChanged: true, wantBilled: 3, wantCharges: 3, wantOwed: 30000,
+		},
+		{
+			name:        "stops at the lease end",
+			lease:       Lease{Status: leaseActive, MonthlyRent: 10000, Start: msOf(jan15), End: msOf(jan15.AddDate(0, 1, 0))},
+			now:         time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+			wantChanged: true, wantBilled: 1, wantCharges: 1, wantOwed: 10000,
+		},
+		{
+			name:        "credit pays the new months first",
+			lease:       Lease{Status: leaseActive, MonthlyRent: 10000, Credit: 15000, Start: msOf(jan15), End: msOf(jan15.AddDate(1, 0, 0))},
+			now:         time.Date(2024, time.February, 20, 0, 0, 0, 0, time.UTC),
+			wantChanged: true, wantBilled: 2, wantCharges: 1, wantOwed: 5000,
+		},
+		{
+			name:        "late fee once the grace period is over",
+			lease:       Lease{Status: leaseActive, MonthlyRent: 10000, Start: msOf(jan15), End: msOf(jan15.AddDate(1, 0, 0))},
+			cp:          PTY{LateFee: 1500, GraceDays: 5},
+			now:         time.Date(2024, time.January, 21, 0, 0, 0, 0, time.UTC),
+			wantChanged: true, wantBilled: 1, wantCharges: 1, wantOwed: 11500, wantFees: 1500,
+		},
+		{
+			name:        "no late fee within the grace period",
+			lease:       Lease{Status: leaseActive, MonthlyRent: 10000, Start: msOf(jan15), End: msOf(jan15.AddDate(1, 0, 0))},
+			cp:          PTY{LateFee: 1500, GraceDays: 5},
+			now:         time.Date(2024, time.January, 19, 0, 0, 0, 0, time.UTC),
+			wantChanged: true, wantBilled: 1, wantCharges: 1, wantOwed: 10000,
+		},
+		{
+			name:  "terminated leases aren't billed",
+			lease: Lease{Status: leaseTerminated, MonthlyRent: 10000, Start: msOf(jan15), End: msOf(jan15.AddDate(1, 0, 0))},
+			now:   time.Date(2024, time.March, 20, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lease := tt.lease
+			changed, err := accrueLease(&lease, tt.cp, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			owed, fees := leaseOwed(lease)
+			if changed != tt.wantChanged || lease.PeriodsBilled != tt.wantBilled || len(lease.Charges) != tt.wantCharges || owed != tt.wantOwed || fees != tt.wantFees || lease.Credit != tt.wantCredit {
+				t.Errorf("changed %v, billed %d, %d charges owing %s with %s fees, credit %s", changed, lease.PeriodsBilled, len(lease.Charges), owed, fees, lease.Credit)
+			}
+
+			// Accruing again at the same time changes nothing
+			changed, err = accrueLease(&lease, tt.cp, tt.now)
+			if err != nil || changed {
+				t.Errorf("accruing twice changed the lease again: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyRentPayment(t *testing.T) {
+	owing := func(status string) Lease {
+		return Lease{
+			Status:      status,
+			MonthlyRent: 10000,
+			Charges: []RentCharge{
+				{Due: "1", Rent: 10000, LateFee: 1500},
+				{Due: "2", Rent: 10000},
+			},
+		}
+	}
+	tests := []struct {
+		name        string
+		lease       Lease
+		payment     Money
+		wantErr     bool
+		wantPaid    Money
+		wantOwed    Money
+		wantCharges int
+		wantCredit  Money
+	}{
+		{"zero pays everything owed", owing(leaseActive), 0, false, 21500, 0, 0, 0},
+		{"part payment goes to the oldest month", owing(leaseActive), 5000, false, 5000, 16500, 2, 0},
+		{"overpayment becomes credit", owing(leaseActive), 31500, false, 31500, 0, 0, 10000},
+		{"zero with nothing owed pays a month ahead", Lease{Status: leaseActive, MonthlyRent: 10000}, 0, false, 10000, 0, 0, 10000},
+		{"negative payment", owing(leaseActive), -1, true, 0, 0, 0, 0},
+		{"ended leases can't take credit", owing(leaseTerminated), 21501, true, 0, 0, 0, 0},
+		{"ended leases can pay what they owe", owing(leaseTerminated), 0, false, 21500, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lease := tt.lease
+			paid, err := applyRentPayment(&lease, tt.payment)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("should have failed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			owed, _ := leaseOwed(lease)
+			if paid != tt.wantPaid || owed != tt.wantOwed || len(lease.Charges) != tt.wantCharges || lease.Credit != tt.wantCredit {
+				t.Errorf("paid %s, %d charges owing %s, credit %s", paid, len(lease.Charges), owed, lease.Credit)
+			}
+		})
+	}
+}
+
+func TestAccrueRent(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	day := 24 * time.Hour
+	leaseID := string(l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'1A','monthlyRent':100,'deposit':0,'start':'0','end':'31536000000'}"))
+	l.invoke("company1", "setLateFee", "{'cusip':'"+cusip+"','lateFee':15,'graceDays':5}")
+
+	l.invokeErr("company2", "accrueRent", "{'cusip':'"+cusip+"'}")
+	l.invokeErr("company1", "accrueRent", "{}")
+	l.invoke("company1", "accrueRent", "{'cusip':'"+cusip+"'}")
+	arrears := func() ArrearsReport {
+		var report ArrearsReport
+		l.queryJSON(&report, "GetArrears", "{'tenant':'company4'}")
+		return report
+	}
+	if report := arrears(); report.Total != 10000 || len(report.Leases) != 1 || report.Leases[0].LeaseID != leaseID {
+		t.Fatalf("arrears after the first month are %+v", report)
+	}
+
+	// 33 days in, February is billed and January is late
+	l.advance(33 * day)
+	l.invoke("admin", "accrueRent", "{}")
+	l.invoke("admin", "accrueRent", "{}")
+	if report := arrears(); report.Total != 21500 || report.Leases[0].LateFees != 1500 || report.Leases[0].OldestDue != "0" {
+		t.Fatalf("arrears after 33 days are %+v", report)
+	}
+
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4','payment':50}")
+	if report := arrears(); report.Total != 16500 {
+		t.Fatalf("arrears after paying 50 are %+v", report)
+	}
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4','payment':315}")
+	if report := arrears(); report.Total != 0 || len(report.Leases) != 0 {
+		t.Fatalf("arrears after paying in full are %+v", report)
+	}
+	if got := l.cash("company4"); got != defaultCashBalance-36500 {
+		t.Errorf("company4 has %s, want 365.00 less", got)
+	}
+
+	// By day 100 March and April are billed against the 150 credit
+	l.advance(67 * day)
+	l.invoke("company1", "accrueRent", "{'cusip':'"+cusip+"'}")
+	if report := arrears(); report.Total != 6500 || report.Leases[0].Charges[0].Paid != 5000 {
+		t.Fatalf("arrears after 100 days are %+v", report)
+	}
+
+	// Ending the lease leaves what it owes to be paid, and no more
+	l.invoke("company4", "terminateLease", "{'leaseId':'"+leaseID+"'}")
+	l.invokeErr("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4','leaseId':'"+leaseID+"','payment':70}")
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4','leaseId':'"+leaseID+"'}")
+	if report := arrears(); report.Total != 0 {
+		t.Fatalf("arrears after settling the ended lease are %+v", report)
+	}
+	l.verify()
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// An account's AssetsIds lists the CUSIPs of the properties it owns or has
+// listed tokens of, in the order it first acquired them. putPTY keeps it up
+// to date whenever a property's holders change.
+
+// syncAssets adds cusip to the AssetsIds of every account in after that
+// wasn't in before, and removes it from every account in before that isn't
+// in after.
+func syncAssets(stub StateStub, cusip string, before []Owner, after []Owner) error {
+	held := map[string]bool{}
+	for _, holder := range before {
+		held[holder.InvestorID] = true
+	}
+	holds := map[string]bool{}
+	for _, holder := range after {
+		holds[holder.InvestorID] = true
+	}
+
+	for _, holder := range after {
+		if !held[holder.InvestorID] {
+			err := updateAssets(stub, holder.InvestorID, cusip, true)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, holder := range before {
+		if !holds[holder.InvestorID] {
+			err := updateAssets(stub, holder.InvestorID, cusip, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func updateAssets(stub StateStub, investorID string, cusip string, holds bool) error {
+	account, err := GetCompany(investorID, stub)
+	if err != nil {
+		fmt.Println("No account " + investorID + " to update the assets of")
+		return nil
+	}
+	if holds {
+		account.AssetsIds = addAsset(account.AssetsIds, cusip)
+	} else {
+		account.AssetsIds = removeAsset(account.AssetsIds, cusip)
+	}
+	return putCompany(stub, account)
+}
+
+func addAsset(assets []string, cusip string) []string {
+	for _, asset := range assets {
+		if asset == cusip {
+			return assets
+		}
+	}
+	return append(assets, cusip)
+}
+
+func removeAsset(assets []string, cusip string) []string {
+	var kept []string
+	for _, asset := range assets {
+		if asset != cusip {
+			kept = append(kept, asset)
+		}
+	}
+	return kept
+}
+
+// repairAssets rebuilds every account's AssetsIds from the properties'
+// owners and listings. Properties an account already lists keep their
+// order, and accounts whose list is already right aren't rewritten.
+func (t *SimpleChaincode) repairAssets(stub StateStub, args []string) ([]byte, error) {
+	_, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	holdings := map[string][]string{}
+	err = scanPrefix(stub, ptyPrefix, func(key string, value []byte) error {
+		var cp PTY
+		err := json.Unmarshal(value, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling cp " + key)
+			return errors.New("Error unmarshalling cp " + key)
+		}
+		for _, holder := range holdersOf(cp) {
+			holdings[holder.InvestorID] = append(holdings[holder.InvestorID], cp.CUSIP)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	repaired := 0
+	err = scanPrefix(stub, accountPrefix, func(key string, value []byte) error {
+		var account Account
+		err := json.Unmarshal(value, &account)
+		if err != nil {
+			fmt.Println("Error unmarshalling account " + key)
+			return errors.New("Error unmarshalling account " + key)
+		}
+
+		held := map[string]bool{}
+		for _, cusip := range holdings[account.ID] {
+			held[cusip] = true
+		}
+		var assets []string
+		for _, cusip := range account.AssetsIds {
+			if held[cusip] {
+				assets = addAsset(assets, cusip)
+			}
+		}
+		for _, cusip := range holdings[account.ID] {
+			assets = addAsset(assets, cusip)
+		}
+
+		if sameAssets(account.AssetsIds, assets) {
+			return nil
+		}
+		account.AssetsIds = assets
+		repaired++
+		return putCompany(stub, account)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Repaired the assets of %d accounts\n", repaired)
+	return nil, nil
+}
+
+func sameAssets(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepairAssets(t *testing.T) {
+	l := newTestLedger(t)
+	a := l.setUp()
+	b := l.issue("company1", "2 Main St", 100)
+	c := l.issue("company1", "3 Main St", 100)
+	for _, cusip := range []string{b, a, c} {
+		l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':10,'sellval':10}")
+		l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':5}")
+	}
+	l.invoke("company3", "transferPaper", "{'cusip':'"+a+"','fromCompany':'company1','toCompany':'company3','quantity':5}")
+	if got := l.account("company2").AssetsIds; !reflect.DeepEqual(got, []string{b, a, c}) {
+		t.Fatalf("company2's assets are %v", got)
+	}
+
+	// company2's list has lost a, gained a property that doesn't exist and
+	// been reordered
+	account := l.account("company2")
+	account.AssetsIds = []string{"gone", c, b}
+	l.putJSON(accountPrefix+"company2", account)
+
+	l.invokeErr("company1", "repairAssets")
+	l.invoke("admin", "repairAssets")
+
+	// What's left of the list keeps its order and the missing property goes
+	// on the end
+	if got := l.account("company2").AssetsIds; !reflect.DeepEqual(got, []string{c, b, a}) {
+		t.Errorf("company2's assets are %v", got)
+	}
+	if got := l.account("company3").AssetsIds; !reflect.DeepEqual(got, []string{a}) {
+		t.Errorf("company3's assets are %v", got)
+	}
+	for _, id := range []string{"admin", "company1", "company2", "company3", "company4"} {
+		var page HistoryPage
+		l.queryJSON(&page, "GetHistory", "{'account':'"+id+"'}")
+		functions := versionFunctions(page)
+		rewritten := functions[len(functions)-1] == "repairAssets"
+		if rewritten != (id == "company2") {
+			t.Errorf("%s's history is %v", id, functions)
+		}
+	}
+	l.verify()
+
+	before := l.stub.snapshot()
+	l.invoke("admin", "repairAssets")
+	if !reflect.DeepEqual(before, l.stub.State) {
+		t.Error("a second run changed the ledger")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Roles an account can hold. admin passes every role check, but it does not
+// let the admin act as another account: moving someone's tokens or cash
+// still needs that account to be the caller.
+const (
+	roleAdmin    = "admin"
+	roleIssuer   = "issuer"
+	roleValuer   = "valuer"
+	roleInvestor = "investor"
+	roleRenter   = "renter"
+)
+
+var knownRoles = []string{roleAdmin, roleIssuer, roleValuer, roleInvestor, roleRenter}
+
+// callerAttribute is the certificate attribute holding the caller's
+// account ID. Users are enrolled with it set to the ID they pass to
+// createAccount.
+const callerAttribute = "account"
+
+// adminKey records the account made admin by Init, so a later call to Init
+// cannot hand out admin again.
+const adminKey = "admin"
+
+type SetRole struct {
+	ID   string `json:"id"`
+	Role string `json:"role"`
+}
+
+// callerID reads the caller's account ID from their certificate.
+func callerID(stub StateStub) (string, error) {
+	idBytes, err := stub.ReadCertAttribute(callerAttribute)
+	if err != nil || len(idBytes) == 0 {
+		fmt.Println("Caller certificate has no " + callerAttribute + " attribute")
+		return "", errors.New("Caller certificate has no " + callerAttribute + " attribute")
+	}
+	return string(idBytes), nil
+}
+
+// getCaller loads the Account belonging to the caller.
+func getCaller(stub StateStub) (Account, error) {
+	id, err := callerID(stub)
+	if err != nil {
+		return Account{}, err
+	}
+	caller, err := GetCompany(id, stub)
+	if err != nil {
+		return caller, errors.New("Caller has no account " + id)
+	}
+	if caller.Closed != "" {
+		return caller, errors.New("Caller's account " + id + " is closed")
+	}
+	return caller, nil
+}
+
+func hasRole(account Account, roles ...string) bool {
+	for _, held := range account.Roles {
+		if held == roleAdmin {
+			return true
+		}
+		for _, role := range roles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requireRole returns the caller's account if it holds any of roles.
+func requireRole(stub StateStub, roles ...string) (Account, error) {
+	caller, err := getCaller(stub)
+	if err != nil {
+		return caller, err
+	}
+	if !hasRole(caller, roles...) {
+		fmt.Println(caller.ID + " does not hold any of the roles " + strings.Join(roles, ", "))
+		return caller, errors.New("Caller " + caller.ID + " needs one of the roles " + strings.Join(roles, ", "))
+	}
+	return caller, nil
+}
+
+// requireCaller is requireRole plus a check that the caller is the account
+// id the request acts for.
+func requireCaller(stub StateStub, id string, roles ...string) (Account, error) {
+	caller, err := requireRole(stub, roles...)
+	if err != nil {
+		return caller, err
+	}
+	if caller.ID != id {
+		fmt.Println("Caller " + caller.ID + " cannot act for " + id)
+		return caller, errors.New("Caller " + caller.ID + " cannot act for " + id)
+	}
+	return caller, nil
+}
+
+// initAdmin makes id the admin account, creating it if needed. It only ever
+// succeeds once per deployment.
+func initAdmin(stub StateStub, id string) error {
+	existing, err := stub.GetState(adminKey)
+	if err != nil {
+		return errors.New("Error reading admin")
+	}
+	if existing != nil {
+		fmt.Println("Admin already set to " + string(existing) + ", ignoring " + id)
+		return nil
+	}
+
+	admin, err := GetCompany(id, stub)
+	if err != nil {
+		admin = Account{ID: id, Prefix: id + "000A", CashBalance: defaultCashBalance, OpeningBalance: defaultCashBalance}
+	}
+	admin.Roles = addRole(admin.Roles, roleAdmin)
+
+	err = putCompany(stub, admin)
+	if err != nil {
+		return err
+	}
+	err = registerAccount(stub, id)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Admin account is " + id)
+	return stub.PutState(adminKey, []byte(id))
+}
+
+func (t *SimpleChaincode) grantRole(stub StateStub, args []string) ([]byte, error) {
+	return t.setRole(stub, args, true)
+}
+
+func (t *SimpleChaincode) revokeRole(stub StateStub, args []string) ([]byte, error) {
+	return t.setRole(stub, args, false)
+}
+
+func (t *SimpleChaincode) setRole(stub StateStub, args []string, grant bool) ([]byte, error) {
+	if len(args) != 1 {
+		fmt.Println("error invalid arguments")
+		return nil, errors.New("Incorrect number of arguments. Expecting role record")
+	}
+
+	_, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	var sr SetRole
+	err = json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &sr)
+	if err != nil {
+		fmt.Println("error invalid role")
+		return nil, errors.New("Invalid role record")
+	}
+
+	known := false
+	for _, role := range knownRoles {
+		if role == sr.Role {
+			known = true
+		}
+	}
+	if !known {
+		return nil, errors.New("Unknown role " + sr.Role)
+	}
+
+	account, err := GetCompany(sr.ID, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	if grant {
+		account.Roles = addRole(account.Roles, sr.Role)
+	} else {
+		if sr.Role == roleAdmin {
+			adminBytes, _ := stub.GetState(adminKey)
+			if string(adminBytes) == sr.ID {
+				return nil, errors.New("Cannot revoke admin from the deployment admin " + sr.ID)
+			}
+		}
+		var roles []string
+		for _, role := range account.Roles {
+			if role != sr.Role {
+				roles = append(roles, role)
+			}
+		}
+		account.Roles = roles
+	}
+
+	err = putCompany(stub, account)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func addRole(roles []string, role string) []string {
+	for _, held := range roles {
+		if held == role {
+			return roles
+		}
+	}
+	return append(roles, role)
+}
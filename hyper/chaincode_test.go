@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLedger drives the chaincode through MemStub the way a peer would: each
+// invoke is its own transaction, run as the account named by the caller.
+type testLedger struct {
+	t    *testing.T
+	cc   *SimpleChaincode
+	stub *MemStub
+}
+
+// newTestLedger deploys the chaincode with "admin" as the admin account.
+func newTestLedger(t *testing.T) *testLedger {
+	l := &testLedger{t: t, cc: new(SimpleChaincode), stub: NewMemStub()}
+	_, err := l.stub.MockInit(l.cc, "init", []string{"admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func (l *testLedger) invoke(caller string, function string, args ...string) []byte {
+	l.t.Helper()
+	l.stub.SetCaller(caller)
+	result, err := l.stub.MockInvoke(l.cc, function, args)
+	if err != nil {
+		l.t.Fatalf("%s by %s: %v", function, caller, err)
+	}
+	return result
+}
+
+// invokeErr runs an invoke that must fail, checks it left no trace and
+// returns its error.
+func (l *testLedger) invokeErr(caller string, function string, args ...string) error {
+	l.t.Helper()
+	before := l.stub.snapshot()
+	l.stub.SetCaller(caller)
+	_, err := l.stub.MockInvoke(l.cc, function, args)
+	if err == nil {
+		l.t.Fatalf("%s by %s should have failed", function, caller)
+	}
+	if !reflect.DeepEqual(before, l.stub.State) {
+		l.t.Fatalf("%s by %s failed but changed state", function, caller)
+	}
+	return err
+}
+
+func (l *testLedger) query(args ...string) []byte {
+	l.t.Helper()
+	result, err := l.stub.MockQuery(l.cc, "query", args)
+	if err != nil {
+		l.t.Fatalf("query %v: %v", args, err)
+	}
+	return result
+}
+
+// queryJSON runs a query and unmarshals its result into v.
+func (l *testLedger) queryJSON(v interface{}, args ...string) {
+	l.t.Helper()
+	err := json.Unmarshal(l.query(args...), v)
+	if err != nil {
+		l.t.Fatalf("query %v: %v", args, err)
+	}
+}
+
+func (l *testLedger) pty(cusip string) PTY {
+	l.t.Helper()
+	var cp PTY
+	l.queryJSON(&cp, "GetPTY", cusip)
+	return cp
+}
+
+func (l *testLedger) account(id string) Account {
+	l.t.Helper()
+	var account Account
+	l.queryJSON(&account, "GetCompany", id)
+	return account
+}
+
+func (l *testLedger) cash(id string) Money {
+	l.t.Helper()
+	return l.account(id).CashBalance
+}
+
+// advance moves the transaction clock on.
+func (l *testLedger) advance(d time.Duration) {
+	l.stub.TxTime = l.stub.TxTime.Add(d)
+}
+
+// millis is the transaction clock as a millisecond timestamp.
+func (l *testLedger) millis() string {
+	return strconv.FormatInt(l.stub.TxTime.UnixNano()/nanosPerMillisecond, 10)
+}
+
+// verify fails the test if verifyState finds anything wrong with the ledger.
+func (l *testLedger) verify() {
+	l.t.Helper()
+	var report StateReport
+	l.queryJSON(&report, "verifyState")
+	for _, violation := range report.Violations {
+		l.t.Errorf("%s %q: %s", violation.Check, violation.Key, violation.Detail)
+	}
+}
+
+// setUp creates company1 to company4 and issues and activates a property of
+// 100 tokens from company1, which is an issuer. company4 is a renter.
+func (l *testLedger) setUp() string {
+	l.t.Helper()
+	l.invoke("admin", "createAccounts", "4")
+	l.invoke("admin", "grantRole", "{'id':'company1','role':'issuer'}")
+	l.invoke("admin", "grantRole", "{'id':'company4','role':'renter'}")
+	return l.issue("company1", "1 Main St", 100)
+}
+
+// issue issues a property in Austin and has the admin approve and activate it.
+func (l *testLedger) issue(issuer string, street string, quantity int) string {
+	l.t.Helper()
+	l.invoke(issuer, "issuePropertyToken", "{'name':'"+street+"','adrStreet':'"+street+"','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':"+strconv.Itoa(quantity)+",'issuer':'"+issuer+"','rent':1000,'mktval':100000}")
+	cusip, err := genHash(street + "Austin78701TX")
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	l.invoke("admin", "approvePTY", "{'cusip':'"+cusip+"'}")
+	l.invoke("admin", "activatePTY", "{'cusip':'"+cusip+"'}")
+	return cusip
+}
+
+// step is one invoke in a scripted flow. Args are a single JSON record with
+// ' for ", the way the CLI examples in the README pass them, and {cusip} is
+// replaced with the property's CUSIP.
+type step struct {
+	caller   string
+	function string
+	args     string
+	wantErr  bool
+}
+
+func (l *testLedger) run(cusip string, steps []step) {
+	l.t.Helper()
+	for _, s := range steps {
+		args := []string{strings.Replace(s.args, "{cusip}", cusip, -1)}
+		if s.wantErr {
+			l.invokeErr(s.caller, s.function, args...)
+		} else {
+			l.invoke(s.caller, s.function, args...)
+		}
+	}
+}
+
+func TestMainFlow(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+
+	l.run(cusip, []step{
+		{"company1", "setForSale", "{'cusip':'{cusip}','fromCompany':'company1','quantity':40,'sellval':10}", false},
+		{"company3", "placeBid", "{'cusip':'{cusip}','invid':'company3','quantity':10,'limitPrice':9}", false},
+		{"company2", "transferPaper", "{'cusip':'{cusip}','fromCompany':'company1','toCompany':'company2','quantity':20}", false},
+		// Crosses the rest of company1's listing at the resting price of 10
+		{"company3", "placeBid", "{'cusip':'{cusip}','invid':'company3','quantity':5,'limitPrice':11}", false},
+		{"company1", "createLease", "{'cusip':'{cusip}','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':0,'start':'0','end':'31536000000'}", false},
+		{"company4", "processRent", "{'cusip':'{cusip}','issuer':'company4'}", false},
+	})
+
+	cp := l.pty(cusip)
+	wantHoldings := []struct {
+		investorID string
+		owned      int
+		listed     int
+	}{
+		{"company1", 60, 15},
+		{"company2", 20, 0},
+		{"company3", 5, 0},
+		{"company4", 0, 0},
+	}
+	for _, want := range wantHoldings {
+		owned, listed := holdingOf(cp, want.investorID)
+		if owned != want.owned || listed != want.listed {
+			t.Errorf("%s holds %d owned and %d listed, want %d and %d", want.investorID, owned, listed, want.owned, want.listed)
+		}
+	}
+	if len(cp.Bids) != 1 || cp.Bids[0].InvestorID != "company3" || cp.Bids[0].Quantity != 10 {
+		t.Errorf("bids are %+v, want company3's 10 at 9", cp.Bids)
+	}
+
+	// The rent of 1000.00 is split 75/20/5 by owned plus listed tokens
+	wantCash := []struct {
+		investorID string
+		cash       Money
+	}{
+		{"company1", defaultCashBalance + 20000 + 5000 + 75000},
+		{"company2", defaultCashBalance - 20000 + 20000},
+		{"company3", defaultCashBalance - 5000 + 5000},
+		{"company4", defaultCashBalance - 100000},
+	}
+	for _, want := range wantCash {
+		if got := l.cash(want.investorID); got != want.cash {
+			t.Errorf("%s has %s, want %s", want.investorID, got, want.cash)
+		}
+	}
+
+	var trades TradePage
+	l.queryJSON(&trades, "GetTrades", "{'cusip':'"+cusip+"'}")
+	if len(trades.Trades) != 2 {
+		t.Errorf("got %d trades, want 2", len(trades.Trades))
+	}
+
+	var all []PTY
+	l.queryJSON(&all, "GetAllPTYs")
+	if len(all) != 1 || all[0].CUSIP != cusip {
+		t.Errorf("GetAllPTYs returned %+v", all)
+	}
+	l.verify()
+}
+
+func TestInvokeErrors(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+
+	tests := []struct {
+		name string
+		step step
+	}{
+		{"unknown function", step{"admin", "mintMoney", "{}", true}},
+		{"Init after deploy", step{"company2", "Init", "company2", true}},
+		{"record isn't JSON", step{"company1", "setForSale", "not json", true}},
+		{"account count isn't a number", step{"admin", "createAccounts", "four", true}},
+		{"property already issued", step{"company1", "issuePropertyToken", "{'adrStreet':'1 Main St','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':10,'issuer':'company1'}", true}},
+		{"listing more than is owned", step{"company1", "setForSale", "{'cusip':'{cusip}','fromCompany':'company1','quantity':101,'sellval':10}", true}},
+		{"buying more than is listed", step{"company2", "transferPaper", "{'cusip':'{cusip}','fromCompany':'company1','toCompany':'company2','quantity':1}", true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			l.run(cusip, []step{tt.step})
+		})
+	}
+	l.t = t
+	l.verify()
+}
+
+func TestInvokeAuthorization(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':10,'sellval':10}")
+
+	tests := []struct {
+		name string
+		step step
+	}{
+		{"investor cannot issue", step{"company2", "issuePropertyToken", "{'name':'2 Main St','adrStreet':'2 Main St','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':10,'issuer':'company2','rent':1000,'mktval':100000}", true}},
+		{"issuer cannot issue for another account", step{"company1", "issuePropertyToken", "{'name':'2 Main St','adrStreet':'2 Main St','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':10,'issuer':'company2','rent':1000,'mktval':100000}", true}},
+		{"issuer cannot suspend", step{"company1", "suspendPTY", "{'cusip':'{cusip}','reason':'x'}", true}},
+		{"only the holder can list", step{"company2", "setForSale", "{'cusip':'{cusip}','fromCompany':'company1','quantity':1,'sellval':1}", true}},
+		{"admin cannot list for another account", step{"admin", "setForSale", "{'cusip':'{cusip}','fromCompany':'company1','quantity':1,'sellval':1}", true}},
+		{"seller cannot call transferPaper", step{"company1", "transferPaper", "{'cusip':'{cusip}','fromCompany':'company1','toCompany':'company2','quantity':1}", true}},
+		{"only the bidder can bid", step{"company2", "placeBid", "{'cusip':'{cusip}','invid':'company3','quantity':1,'limitPrice':1}", true}},
+		{"investor cannot grant roles", step{"company2", "grantRole", "{'id':'company2','role':'admin'}", true}},
+		{"valuer role needed for updateMktVal", step{"company1", "updateMktVal", "{'cusip':'{cusip}','mktval':1}", true}},
+		{"renter cannot pay for another tenant", step{"company2", "processRent", "{'cusip':'{cusip}','issuer':'company4'}", true}},
+		{"unknown caller", step{"nobody", "setForSale", "{'cusip':'{cusip}','fromCompany':'nobody','quantity':1,'sellval':1}", true}},
+	}
+	// Every payload is otherwise valid, so each refusal must come from the
+	// caller checks
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			err := l.invokeErr(tt.step.caller, tt.step.function, strings.Replace(tt.step.args, "{cusip}", cusip, -1))
+			if !strings.HasPrefix(err.Error(), "Caller") {
+				t.Errorf("refused for %q, not the caller", err)
+			}
+		})
+	}
+	l.t = t
+	l.verify()
+}
+
+func TestTransferPaper(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':40,'sellval':10}")
+
+	// Buying the whole listing leaves no empty ForSale entry behind
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':40}")
+	cp := l.pty(cusip)
+	if len(cp.PT4Sale) != 0 {
+		t.Fatalf("after buying the whole listing listings are %+v", cp.PT4Sale)
+	}
+	if owned, _ := holdingOf(cp, "company2"); owned != 40 {
+		t.Fatalf("company2 owns %d, want 40", owned)
+	}
+
+	// 11 at 1000000.00 is more than company3's 10000000.00
+	l.invoke("company2", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company2','quantity':40,'sellval':1000000}")
+	l.invokeErr("company3", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company2','toCompany':'company3','quantity':11}")
+	l.invoke("company3", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company2','toCompany':'company3','quantity':10}")
+	if got := l.cash("company3"); got != 0 {
+		t.Errorf("company3 has %s left, want 0.00", got)
+	}
+	l.verify()
+}
+
+func TestIssuePropertyToken(t *testing.T) {
+	l := newTestLedger(t)
+	l.setUp()
+
+	tests := []struct {
+		name    string
+		payload string
+		wantErr bool
+	}{
+		{"zero quantity", "{'adrStreet':'2 Main St','quantity':0,'issuer':'company1'}", true},
+		{"negative quantity", "{'adrStreet':'3 Main St','quantity':-5,'issuer':'company1'}", true},
+		{"owners and listings in the payload are ignored", "{'adrStreet':'4 Main St','quantity':10,'issuer':'company1','owner':[{'invid':'company2','quantity':1000}],'forsale':[{'invid':'company1','quantity':500,'sellval':1}]}", false},
+		{"rent settings in the payload are ignored", "{'adrStreet':'5 Main St','quantity':10,'issuer':'company1','distribution':'net','reservePct':150,'lateFee':-5,'graceDays':-3}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			if tt.wantErr {
+				l.invokeErr("company1", "issuePropertyToken", tt.payload)
+				return
+			}
+			l.invoke("company1", "issuePropertyToken", tt.payload)
+		})
+	}
+	l.t = t
+
+	cusip, _ := genHash("4 Main St")
+	cp := l.pty(cusip)
+	if cp.Qty != 10 || len(cp.Owners) != 1 || cp.Owners[0].InvestorID != "company1" || cp.Owners[0].Quantity != 10 || len(cp.PT4Sale) != 0 {
+		t.Errorf("issued %d tokens with owners %+v and listings %+v", cp.Qty, cp.Owners, cp.PT4Sale)
+	}
+	cusip, _ = genHash("5 Main St")
+	cp = l.pty(cusip)
+	if cp.Distribution != distributeGross || cp.ReservePct != 0 || cp.LateFee != 0 || cp.GraceDays != 0 {
+		t.Errorf("issued with distribution %q, reserve %d%%, late fee %s after %d days", cp.Distribution, cp.ReservePct, cp.LateFee, cp.GraceDays)
+	}
+	l.verify()
+}
+
+func TestFailedInvokeRollsBack(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':10,'sellval':10}")
+
+	// Buying more than is listed fails part way through the transfer
+	l.invokeErr("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':11}")
+	if owned, listed := holdingOf(l.pty(cusip), "company1"); owned != 90 || listed != 10 {
+		t.Errorf("company1 holds %d owned and %d listed after a failed transfer", owned, listed)
+	}
+	l.verify()
+}
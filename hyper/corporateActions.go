@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	corpActionSplit       = "split"
+	corpActionConsolidate = "consolidate"
+)
+
+// CorporateAction is a change to a property's token count that every holder
+// shares, kept on the PTY so its history can be read back.
+type CorporateAction struct {
+	Type       string       `json:"type"`
+	Ratio      int          `json:"ratio"`
+	QtyBefore  int          `json:"qtyBefore"`
+	QtyAfter   int          `json:"qtyAfter"`
+	Quantity   int          `json:"quantity,omitempty"`
+	Price      Money        `json:"price,omitempty"`
+	Amount     Money        `json:"amount,omitempty"`
+	CashInLieu []CashInLieu `json:"cashInLieu"`
+	PaidBy     string       `json:"paidBy"`
+	TxID       string       `json:"txId"`
+	Date       string       `json:"date"`
+}
+
+// CashInLieu is what a holder was paid for the Tokens that didn't make up a
+// whole new token in a consolidation.
+type CashInLieu struct {
+	InvestorID string `json:"invid"`
+	Tokens     int    `json:"tokens"`
+	Amount     Money  `json:"amount"`
+}
+
+type TokenRatio struct {
+	CUSIP string `json:"cusip"`
+	Ratio int    `json:"ratio"`
+}
+
+// splitTokens turns every token of a property into Ratio tokens. Holdings,
+// listings and bids are multiplied by Ratio and their prices divided by it.
+func (t *SimpleChaincode) splitTokens(stub StateStub, args []string) ([]byte, error) {
+	return t.corporateAction(stub, args, corpActionSplit)
+}
+
+// consolidateTokens turns every Ratio tokens of a property into one.
+// Holdings that don't divide evenly are rounded down and the holder is paid
+// cash in lieu of the rest by the issuer, at MktValue / Qty per old token.
+// Only the issuer itself can consolidate.
+func (t *SimpleChaincode) consolidateTokens(stub StateStub, args []string) ([]byte, error) {
+	return t.corporateAction(stub, args, corpActionConsolidate)
+}
+
+func (t *SimpleChaincode) corporateAction(stub StateStub, args []string, actionType string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting ratio record")
+	}
+
+	var tr TokenRatio
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &tr)
+	if err != nil {
+		fmt.Println("Error Unmarshalling TokenRatio")
+		return nil, errors.New("Invalid ratio record")
+	}
+	if tr.Ratio < 2 {
+		return nil, errors.New("The ratio must be 2 or more")
+	}
+
+	cp, err := GetPTY(tr.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	if actionType == corpActionConsolidate {
+		// Cash in lieu comes out of the issuer's own account, so the admin
+		// can't consolidate for them
+		_, err = requireCaller(stub, cp.Issuer, roleIssuer)
+	} else {
+		err = requirePropertyIssuer(stub, cp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if hasStatus(cp, statusDelisted, statusSold) {
+		return nil, errors.New("Property " + cp.CUSIP + " is " + cp.Status)
+	}
+	if cp.Offering != nil {
+		return nil, errors.New("Property " + cp.CUSIP + " has offering " + cp.Offering.OfferID + " open")
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var action CorporateAction
+	action.Type = actionType
+	action.Ratio = tr.Ratio
+	action.QtyBefore = cp.Qty
+	action.TxID = stub.GetTxID()
+	action.Date = now
+
+	if actionType == corpActionSplit {
+		err = splitHoldings(&cp, tr.Ratio)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		action.CashInLieu, err = consolidateHoldings(&cp, tr.Ratio)
+		if err != nil {
+			return nil, err
+		}
+		action.PaidBy = cp.Issuer
+		err = payCashInLieu(stub, cp.Issuer, action.CashInLieu)
+		if err != nil {
+			return nil, err
+		}
+	}
+	action.QtyAfter = cp.Qty
+	cp.CorporateActions = append(cp.CorporateActions, action)
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println(actionType + " of " + cp.CUSIP + " by " + strconv.Itoa(tr.Ratio) + ": " + strconv.Itoa(action.QtyBefore) + " to " + strconv.Itoa(action.QtyAfter) + " tokens")
+	return nil, nil
+}
+
+// maxQuantity is the largest token quantity an int holds.
+const maxQuantity = int(^uint(0) >> 1)
+
+// splitHoldings multiplies every quantity on cp by ratio and divides every
+// price by it, in memory. It refuses a ratio that would overflow a quantity.
+func splitHoldings(cp *PTY, ratio int) error {
+	quantities := []int{cp.Qty}
+	for _, bid := range cp.Bids {
+		quantities = append(quantities, bid.Quantity)
+	}
+	for _, quantity := range quantities {
+		if quantity > maxQuantity/ratio {
+			return errors.New("A split by " + strconv.Itoa(ratio) + " would overflow the token quantities of " + cp.CUSIP)
+		}
+	}
+
+	cp.Qty *= ratio
+	for i := range cp.Owners {
+		cp.Owners[i].Quantity *= ratio
+	}
+	for i := range cp.PT4Sale {
+		cp.PT4Sale[i].Quantity *= ratio
+		cp.PT4Sale[i].SellVal = cp.PT4Sale[i].SellVal.Div(ratio)
+	}
+	for i := range cp.Bids {
+		cp.Bids[i].Quantity *= ratio
+		cp.Bids[i].LimitPrice = cp.Bids[i].LimitPrice.Div(ratio)
+	}
+	return nil
+}
+
+// consolidateHoldings divides every holder's owned plus listed quantity on
+// cp by ratio, in memory. Listings are consolidated first and the owned
+// entry takes the rest of the holder's new quantity. It returns the cash in
+// lieu due for the old tokens left over.
+func consolidateHoldings(cp *PTY, ratio int) ([]CashInLieu, error) {
+	holders := holdersOf(*cp)
+	held := 0
+	for _, holder := range holders {
+		held += holder.Quantity
+	}
+
+	var cash []CashInLieu
+	newTotals := map[string]int{}
+	for _, holder := range holders {
+		newTotals[holder.InvestorID] = holder.Quantity / ratio
+		left := holder.Quantity % ratio
+		if left == 0 {
+			continue
+		}
+		if cp.MktValue <= 0 {
+			return nil, errors.New("Property " + cp.CUSIP + " needs a market value to pay cash in lieu")
+		}
+		cash = append(cash, CashInLieu{InvestorID: holder.InvestorID, Tokens: left, Amount: cp.MktValue.MulInt(left).Div(cp.Qty)})
+	}
+
+	newHeld := 0
+	var listings []ForSale
+	for _, forsale := range cp.PT4Sale {
+		forsale.Quantity /= ratio
+		forsale.SellVal = forsale.SellVal.MulInt(ratio)
+		newTotals[forsale.InvestorID] -= forsale.Quantity
+		newHeld += forsale.Quantity
+		if forsale.Quantity > 0 {
+			listings = append(listings, forsale)
+		}
+	}
+	cp.PT4Sale = listings
+
+	var owners []Owner
+	for _, owner := range cp.Owners {
+		owner.Quantity = newTotals[owner.InvestorID]
+		newTotals[owner.InvestorID] = 0
+		newHeld += owner.Quantity
+		if owner.Quantity > 0 {
+			owners = append(owners, owner)
+		}
+	}
+	cp.Owners = owners
+
+	var bids []Bid
+	for _, bid := range cp.Bids {
+		bid.Quantity /= ratio
+		bid.LimitPrice = bid.LimitPrice.MulInt(ratio)
+		if bid.Quantity > 0 {
+			bids = append(bids, bid)
+		}
+	}
+	cp.Bids = bids
+
+	// Tokens nobody holds consolidate too; the fractions bought out are gone
+	cp.Qty = newHeld + (cp.Qty-held)/ratio
+	return cash, nil
+}
+
+// payCashInLieu moves the cash in lieu from payer to each holder.
+func payCashInLieu(stub StateStub, payer string, cash []CashInLieu) error {
+	var total Money
+	for _, c := range cash {
+		total += c.Amount
+	}
+	if total == 0 {
+		return nil
+	}
+
+	account, err := GetCompany(payer, stub)
+	if err != nil {
+		return err
+	}
+	if account.CashBalance < total {
+		return errors.New("The company " + payer + " doesn't have the " + total.String() + " needed for cash in lieu")
+	}
+	account.CashBalance -= total
+	err = putCompany(stub, account)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cash {
+		holder, err := GetCompany(c.InvestorID, stub)
+		if err != nil {
+			return err
+		}
+		holder.CashBalance += c.Amount
+		err = putCompany(stub, holder)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSplitAndConsolidate(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':31}")
+	l.invoke("company3", "placeBid", "{'cusip':'"+cusip+"','invid':'company3','quantity':5,'limitPrice':9}")
+
+	l.invokeErr("company2", "splitTokens", "{'cusip':'"+cusip+"','ratio':2}")
+	l.invokeErr("company1", "splitTokens", "{'cusip':'"+cusip+"','ratio':1}")
+	l.invokeErr("admin", "splitTokens", "{'cusip':'"+cusip+"','ratio':"+strconv.Itoa(maxQuantity/50)+"}")
+	l.invoke("admin", "splitTokens", "{'cusip':'"+cusip+"','ratio':3}")
+	cp := l.pty(cusip)
+	if owned, _ := holdingOf(cp, "company2"); cp.Qty != 300 || owned != 93 {
+		t.Fatalf("after the split there are %d tokens and company2 owns %d", cp.Qty, owned)
+	}
+	if cp.PT4Sale[0].Quantity != 207 || cp.PT4Sale[0].SellVal != 333 || cp.Bids[0].Quantity != 15 || cp.Bids[0].LimitPrice != 300 {
+		t.Fatalf("after the split listings are %+v and bids %+v", cp.PT4Sale, cp.Bids)
+	}
+
+	// Cash in lieu comes out of company1's account, so only it can
+	// consolidate
+	l.invokeErr("admin", "consolidateTokens", "{'cusip':'"+cusip+"','ratio':10}")
+	l.invokeErr("company2", "consolidateTokens", "{'cusip':'"+cusip+"','ratio':10}")
+
+	// company2's 93 become 9 plus cash for 3, company1's 207 listed become
+	// 20 plus cash for 7, both at 100000.00 / 300 per old token
+	issuerCash, holderCash := l.cash("company1"), l.cash("company2")
+	l.invoke("company1", "consolidateTokens", "{'cusip':'"+cusip+"','ratio':10}")
+	cp = l.pty(cusip)
+	if owned, _ := holdingOf(cp, "company2"); cp.Qty != 29 || owned != 9 {
+		t.Fatalf("after consolidating there are %d tokens and company2 owns %d", cp.Qty, owned)
+	}
+	if cp.PT4Sale[0].Quantity != 20 || cp.PT4Sale[0].SellVal != 3330 || cp.Bids[0].Quantity != 1 || cp.Bids[0].LimitPrice != 3000 {
+		t.Fatalf("after consolidating listings are %+v and bids %+v", cp.PT4Sale, cp.Bids)
+	}
+	if got := l.cash("company2") - holderCash; got != 100000 {
+		t.Errorf("company2 was paid %s, want 1000.00", got)
+	}
+	if got := issuerCash - l.cash("company1"); got != 100000 {
+		t.Errorf("company1 paid out %s net, want 1000.00", got)
+	}
+	if len(cp.CorporateActions) != 2 || cp.CorporateActions[1].QtyBefore != 300 || cp.CorporateActions[1].PaidBy != "company1" || len(cp.CorporateActions[1].CashInLieu) != 2 {
+		t.Errorf("corporate actions are %+v", cp.CorporateActions)
+	}
+	l.verify()
+}
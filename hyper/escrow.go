@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type EscrowQuery struct {
+	LeaseID string `json:"leaseId"`
+	Tenant  string `json:"tenant"`
+	CUSIP   string `json:"cusip"`
+}
+
+// EscrowEntry is the deposit on one lease: what was paid in, what is still
+// held and how it was settled.
+type EscrowEntry struct {
+	LeaseID         string `json:"leaseId"`
+	CUSIP           string `json:"cusip"`
+	Tenant          string `json:"tenant"`
+	Unit            string `json:"unit"`
+	Status          string `json:"status"`
+	Deposit         Money  `json:"deposit"`
+	Held            Money  `json:"held"`
+	Returned        Money  `json:"returned"`
+	Deducted        Money  `json:"deducted"`
+	DeductionReason string `json:"deductionReason"`
+}
+
+type EscrowReport struct {
+	Held     Money         `json:"held"`
+	Deposits []EscrowEntry `json:"deposits"`
+}
+
+// holdDeposit moves the lease deposit out of the tenant's cash into escrow.
+// Both are only changed in memory.
+func holdDeposit(tenant *Account, lease *Lease) error {
+	if lease.Deposit == 0 {
+		return nil
+	}
+	if tenant.CashBalance < lease.Deposit {
+		fmt.Println("The company " + tenant.ID + " doesn't have enough cash for the deposit")
+		return errors.New("The company " + tenant.ID + " doesn't have enough cash for the deposit")
+	}
+	tenant.CashBalance -= lease.Deposit
+	tenant.Escrow += lease.Deposit
+	lease.Escrow = lease.Deposit
+	return nil
+}
+
+// releaseDeposit empties the lease's escrow, keeping back deduction for the
+// holders and returning the rest to the tenant. Both are only changed in
+// memory; the caller pays the deduction out with creditHolders.
+func releaseDeposit(tenant *Account, lease *Lease, deduction Money, reason string) error {
+	if deduction < 0 || deduction > lease.Escrow {
+		return errors.New("The deduction has to be between 0 and the " + lease.Escrow.String() + " held on lease " + lease.LeaseID)
+	}
+	returned := lease.Escrow - deduction
+	tenant.Escrow -= lease.Escrow
+	tenant.CashBalance += returned
+	lease.Escrow = 0
+	lease.DepositReturned = returned
+	lease.DepositDeducted = deduction
+	lease.DeductionReason = reason
+	return nil
+}
+
+// GetEscrow lists lease deposits for a lease, a tenant or a property, with
+// the total still held.
+func GetEscrow(args string, stub StateStub) (EscrowReport, error) {
+	var report EscrowReport
+	var eq EscrowQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &eq)
+	if err != nil {
+		return report, errors.New("Invalid escrow query")
+	}
+	if eq.LeaseID == "" && eq.Tenant == "" && eq.CUSIP == "" {
+		return report, errors.New("GetEscrow expects {\"leaseId\": ...}, {\"tenant\": ...} or {\"cusip\": ...}")
+	}
+
+	add := func(lease Lease) {
+		var entry EscrowEntry
+		entry.LeaseID = lease.LeaseID
+		entry.CUSIP = lease.CUSIP
+		entry.Tenant = lease.Tenant
+		entry.Unit = lease.Unit
+		entry.Status = lease.Status
+		entry.Deposit = lease.Deposit
+		entry.Held = lease.Escrow
+		entry.Returned = lease.DepositReturned
+		entry.Deducted = lease.DepositDeducted
+		entry.DeductionReason = lease.DeductionReason
+		report.Deposits = append(report.Deposits, entry)
+		report.Held += lease.Escrow
+	}
+
+	if eq.LeaseID != "" {
+		lease, err := GetLease(eq.LeaseID, stub)
+		if err != nil {
+			return report, err
+		}
+		add(lease)
+		return report, nil
+	}
+
+	err = scanPrefix(stub, leasePrefix, func(key string, value []byte) error {
+		var lease Lease
+		err := json.Unmarshal(value, &lease)
+		if err != nil {
+			return errors.New("Error unmarshalling lease " + key)
+		}
+		if eq.Tenant != "" && lease.Tenant != eq.Tenant {
+			return nil
+		}
+		if eq.CUSIP != "" && lease.CUSIP != eq.CUSIP {
+			return nil
+		}
+		if lease.Deposit > 0 {
+			add(lease)
+		}
+		return nil
+	})
+	return report, err
+}
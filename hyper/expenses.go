@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var expensePrefix = "expense:"
+
+// Index object type for expenses. Each entry's key is (type, cusip, padded
+// timestamp, expense ID), so GetExpenses pages a property's bills in the
+// order they were recorded.
+const expensesByCUSIP = "expense~cusip"
+
+const (
+	expenseOutstanding = "Outstanding"
+	expensePaid        = "Paid"
+)
+
+// Distribution modes. Gross pays rent after the reserve to the holders; net
+// also pays outstanding expenses first.
+const (
+	distributeGross = "gross"
+	distributeNet   = "net"
+)
+
+var expenseCategories = []string{"management", "repairs", "insurance", "tax", "utilities", "other"}
+
+// Expense is a bill against a property, paid to Payee out of rent when the
+// property distributes net, or from the reserve once the admin approves it.
+type Expense struct {
+	ExpenseID   string `json:"expenseId"`
+	CUSIP       string `json:"cusip"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+	Paid        Money  `json:"paid"`
+	Payee       string `json:"payee"`
+	Link        UrlLnk `json:"link"`
+	Status      string `json:"status"`
+	ApprovedBy  string `json:"approvedBy"`
+	RecordedBy  string `json:"recordedBy"`
+	Recorded    string `json:"recorded"`
+	Settled     string `json:"settled"`
+}
+
+type RecordExpense struct {
+	CUSIP       string `json:"cusip"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Amount      Money  `json:"amount"`
+	Payee       string `json:"payee"`
+	Link        UrlLnk `json:"link"`
+}
+
+type SetDistribution struct {
+	CUSIP      string `json:"cusip"`
+	Mode       string `json:"mode"`
+	ReservePct int    `json:"reservePct"`
+}
+
+type ExpenseQuery struct {
+	CUSIP  string `json:"cusip"`
+	Status string `json:"status"`
+	PageQuery
+}
+
+type ExpensePage struct {
+	Expenses []Expense `json:"expenses"`
+	Bookmark string    `json:"bookmark"`
+}
+
+// ExpensePayment is what one rent payment put towards an expense.
+type ExpensePayment struct {
+	ExpenseID string `json:"expenseId"`
+	Payee     string `json:"payee"`
+	Amount    Money  `json:"amount"`
+}
+
+// RentSplit is where a rent payment went: the reserve, expenses, and the
+// holders' shares of what was left.
+type RentSplit struct {
+	Reserve  Money
+	Expenses []ExpensePayment
+	Holders  []Owner
+	Shares   []Money
+}
+
+// recordExpense adds an outstanding expense to a property. Only its issuer
+// can record expenses.
+func (t *SimpleChaincode) recordExpense(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting expense record")
+	}
+
+	var re RecordExpense
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &re)
+	if err != nil {
+		fmt.Println("Error Unmarshalling RecordExpense")
+		return nil, errors.New("Invalid expense record")
+	}
+
+	cp, err := GetPTY(re.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validExpenseCategory(re.Category) {
+		return nil, errors.New("Expense category must be one of " + strings.Join(expenseCategories, ", "))
+	}
+	if re.Amount <= 0 {
+		return nil, errors.New("Expense amount must be positive")
+	}
+	_, err = GetCompany(re.Payee, stub)
+	if err != nil {
+		return nil, errors.New("Payee " + re.Payee + " has no account")
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var expense Expense
+	expense.ExpenseID, err = newRecordID(stub, expensePrefix)
+	if err != nil {
+		return nil, err
+	}
+	expense.CUSIP = cp.CUSIP
+	expense.Category = re.Category
+	expense.Description = re.Description
+	expense.Amount = re.Amount
+	expense.Payee = re.Payee
+	expense.Link = re.Link
+	expense.Status = expenseOutstanding
+	expense.RecordedBy = caller.ID
+	expense.Recorded = now
+
+	err = putExpense(stub, expense)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(compositeKey(expensesByCUSIP, cp.CUSIP, padMillis(now), expense.ExpenseID), []byte(expense.ExpenseID))
+	if err != nil {
+		return nil, errors.New("Error writing expense index for " + expense.ExpenseID)
+	}
+
+	cp.OpenExpenses = append(cp.OpenExpenses, expense.ExpenseID)
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Recorded expense " + expense.ExpenseID + " on " + cp.CUSIP)
+	return []byte(expense.ExpenseID), nil
+}
+
+// setDistribution switches a property between gross and net rent
+// distribution and sets the percentage of rent kept in reserve.
+func (t *SimpleChaincode) setDistribution(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting distribution record")
+	}
+
+	var sd SetDistribution
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &sd)
+	if err != nil {
+		fmt.Println("Error Unmarshalling SetDistribution")
+		return nil, errors.New("Invalid distribution record")
+	}
+	if sd.Mode != distributeGross && sd.Mode != distributeNet {
+		return nil, errors.New("Distribution mode must be " + distributeGross + " or " + distributeNet)
+	}
+	if sd.ReservePct < 0 || sd.ReservePct > 100 {
+		return nil, errors.New("Reserve percentage must be between 0 and 100")
+	}
+
+	cp, err := GetPTY(sd.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	cp.Distribution = sd.Mode
+	cp.ReservePct = sd.ReservePct
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// distributeRent pays out rent received on cp. The reserve percentage is
+// taken first. Under net distribution outstanding expenses are then paid
+// oldest first. The holders share what is left. cp's Reserve and
+// OpenExpenses are updated in memory; the expenses and accounts are written
+// here.
+func distributeRent(stub StateStub, cp *PTY, amount Money) (RentSplit, error) {
+	var split RentSplit
+	split.Reserve = amount.MulInt(cp.ReservePct).Div(100)
+	left := amount - split.Reserve
+	if split.Reserve < 0 || left < 0 {
+		fmt.Println("Property " + cp.CUSIP + " has a reserve percentage outside 0 to 100")
+		return split, errors.New("Property " + cp.CUSIP + " has a reserve percentage outside 0 to 100")
+	}
+	cp.Reserve += split.Reserve
+
+	if cp.Distribution == distributeNet {
+		var err error
+		split.Expenses, left, err = payOpenExpenses(stub, cp, left)
+		if err != nil {
+			return split, err
+		}
+	}
+
+	var err error
+	split.Holders, split.Shares, err = creditHolders(stub, *cp, left)
+	return split, err
+}
+
+// payOpenExpenses pays cp's outstanding expenses oldest first out of
+// available, and returns the payments made and what is left. cp's
+// OpenExpenses is updated in memory.
+func payOpenExpenses(stub StateStub, cp *PTY, available Money) ([]ExpensePayment, Money, error) {
+	var payments []ExpensePayment
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, available, errors.New("Error reading transaction timestamp")
+	}
+
+	left := available
+	var open []string
+	for _, expenseID := range cp.OpenExpenses {
+		expense, err := GetExpense(expenseID, stub)
+		if err != nil {
+			return nil, available, err
+		}
+		pay := expense.Amount - expense.Paid
+		if left < pay {
+			pay = left
+		}
+		if pay > 0 {
+			err = payExpense(stub, &expense, pay, now)
+			if err != nil {
+				return nil, available, err
+			}
+			left -= pay
+			payments = append(payments, ExpensePayment{ExpenseID: expense.ExpenseID, Payee: expense.Payee, Amount: pay})
+		}
+		if expense.Status == expenseOutstanding {
+			open = append(open, expenseID)
+		}
+	}
+	cp.OpenExpenses = open
+	return payments, left, nil
+}
+
+// payExpense pays amount towards an expense, crediting the payee, and marks
+// it paid once it is paid in full.
+func payExpense(stub StateStub, expense *Expense, amount Money, when string) error {
+	payee, err := GetCompany(expense.Payee, stub)
+	if err != nil {
+		return errors.New("Failed to pay expense " + expense.ExpenseID + " to " + expense.Payee)
+	}
+	payee.CashBalance += amount
+	err = putCompany(stub, payee)
+	if err != nil {
+		return err
+	}
+
+	expense.Paid += amount
+	if expense.Paid == expense.Amount {
+		expense.Status = expensePaid
+		expense.Settled = when
+	}
+	return putExpense(stub, *expense)
+}
+
+func validExpenseCategory(category string) bool {
+	for _, c := range expenseCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func putExpense(stub StateStub, expense Expense) error {
+	expenseBytes, err := json.Marshal(&expense)
+	if err != nil {
+		fmt.Println("Error marshalling expense " + expense.ExpenseID)
+		return errors.New("Error marshalling expense " + expense.ExpenseID)
+	}
+	err = stub.PutState(expensePrefix+expense.ExpenseID, expenseBytes)
+	if err != nil {
+		fmt.Println("Error writing expense " + expense.ExpenseID)
+		return errors.New("Error writing expense " + expense.ExpenseID)
+	}
+	return nil
+}
+
+func GetExpense(expenseID string, stub StateStub) (Expense, error) {
+	var expense Expense
+	expenseBytes, err := stub.GetState(expensePrefix + expenseID)
+	if err != nil || expenseBytes == nil {
+		fmt.Println("Expense not found " + expenseID)
+		return expense, errors.New("Expense not found " + expenseID)
+	}
+	err = json.Unmarshal(expenseBytes, &expense)
+	if err != nil {
+		fmt.Println("Error unmarshalling expense " + expenseID)
+		return expense, errors.New("Error unmarshalling expense " + expenseID)
+	}
+	return expense, nil
+}
+
+// GetExpenses pages through a property's expenses, oldest first, optionally
+// only those with the given status.
+func GetExpenses(args string, stub StateStub) (ExpensePage, error) {
+	var page ExpensePage
+	var eq ExpenseQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &eq)
+	if err != nil || eq.CUSIP == "" {
+		return page, errors.New("GetExpenses expects {\"cusip\": ...}")
+	}
+
+	bookmark, err := pageIndex(stub, compositeKey(expensesByCUSIP, eq.CUSIP), eq.PageQuery, func(key string, value []byte) error {
+		expense, err := GetExpense(string(value), stub)
+		if err != nil {
+			return err
+		}
+		if eq.Status != "" && expense.Status != eq.Status {
+			return nil
+		}
+		page.Expenses = append(page.Expenses, expense)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+	page.Bookmark = bookmark
+	return page, nil
+}
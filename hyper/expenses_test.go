@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestDistributeRent(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+
+	tests := []struct {
+		name        string
+		reservePct  int
+		wantErr     bool
+		wantReserve Money
+		wantHolders Money
+	}{
+		{"no reserve", 0, false, 0, 100000},
+		{"part to the reserve", 10, false, 10000, 90000},
+		{"all to the reserve", 100, false, 100000, 0},
+		{"over 100%", 150, true, 0, 0},
+		{"negative", -10, true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := l.pty(cusip)
+			cp.ReservePct = tt.reservePct
+			split, err := distributeRent(l.stub, &cp, 100000)
+			if tt.wantErr {
+				if err == nil || cp.Reserve != 0 {
+					t.Errorf("should have failed, reserve is %s", cp.Reserve)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if split.Reserve != tt.wantReserve || cp.Reserve != tt.wantReserve || len(split.Shares) != 1 || split.Shares[0] != tt.wantHolders {
+				t.Errorf("split is %+v with reserve %s", split, cp.Reserve)
+			}
+		})
+	}
+}
+
+func TestNetDistribution(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':0,'start':'0','end':'31536000000'}")
+	l.invokeErr("company1", "setDistribution", "{'cusip':'"+cusip+"','mode':'net','reservePct':101}")
+	l.invoke("company1", "setDistribution", "{'cusip':'"+cusip+"','mode':'net','reservePct':10}")
+	l.invoke("company1", "recordExpense", "{'cusip':'"+cusip+"','category':'repairs','amount':300,'payee':'company2'}")
+
+	// 100 to the reserve, 300 to the payee and the 600 left to company1
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4'}")
+	if cp := l.pty(cusip); cp.Reserve != 10000 || len(cp.OpenExpenses) != 0 {
+		t.Errorf("reserve is %s with open expenses %v", cp.Reserve, cp.OpenExpenses)
+	}
+	if got := l.cash("company2"); got != defaultCashBalance+30000 {
+		t.Errorf("company2 has %s, want 300.00 more", got)
+	}
+	if got := l.cash("company1"); got != defaultCashBalance+60000 {
+		t.Errorf("company1 has %s, want 600.00 more", got)
+	}
+	l.verify()
+}
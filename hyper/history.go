@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The peer keeps no history of a key, so every version of a property or
+// account written through putPTY or putCompany is also saved in a version
+// log. Each entry's key is (type, state key, padded timestamp, padded
+// sequence number) and, unlike the other indexes, its value is the Version
+// itself. The sequence number orders versions written in the same
+// millisecond. latestVersion maps each state key to its newest log entry.
+// A key written more than once in a transaction keeps only its last version,
+// the same way the ledger only commits the last write.
+const (
+	versionsByKey = "version~key"
+	latestVersion = "version~latest"
+)
+
+// Version is a property or account as one transaction left it. Seq counts
+// the key's versions from 1, and Function is the invoke that wrote it.
+type Version struct {
+	Key       string          `json:"key"`
+	Seq       int             `json:"seq"`
+	TxID      string          `json:"txId"`
+	Timestamp string          `json:"timestamp"`
+	Function  string          `json:"function"`
+	Value     json.RawMessage `json:"value"`
+}
+
+// HistoryQuery picks a property by CUSIP or an account by ID. With At set,
+// GetHistory returns just the version in force at that millisecond
+// timestamp; otherwise it pages through every version, oldest first.
+type HistoryQuery struct {
+	CUSIP   string `json:"cusip"`
+	Account string `json:"account"`
+	At      string `json:"at"`
+	PageQuery
+}
+
+type HistoryPage struct {
+	Versions []Version `json:"versions"`
+	Bookmark string    `json:"bookmark"`
+}
+
+// invocation is a StateStub that knows which function is being invoked, so
+// the version log can say what made each change.
+type invocation struct {
+	StateStub
+	function string
+}
+
+func withFunction(stub StateStub, function string) StateStub {
+	if inv, ok := stub.(*invocation); ok {
+		stub = inv.StateStub
+	}
+	return &invocation{StateStub: stub, function: function}
+}
+
+// txFunction is the function being invoked, or "" outside an invoke.
+func txFunction(stub StateStub) string {
+	if inv, ok := stub.(*invocation); ok {
+		return inv.function
+	}
+	return ""
+}
+
+// recordVersion adds value to key's version log.
+func recordVersion(stub StateStub, key string, value []byte) error {
+	now, err := txMillis(stub)
+	if err != nil {
+		return errors.New("Error reading transaction timestamp")
+	}
+
+	version := Version{
+		Key:       key,
+		Seq:       1,
+		TxID:      stub.GetTxID(),
+		Timestamp: now,
+		Function:  txFunction(stub),
+		Value:     json.RawMessage(value),
+	}
+
+	latestKey := compositeKey(latestVersion, key)
+	logKey := ""
+	previousKey, err := stub.GetState(latestKey)
+	if err != nil {
+		return errors.New("Error reading latest version of " + key)
+	}
+	if previousKey != nil {
+		previousBytes, err := stub.GetState(string(previousKey))
+		if err != nil || previousBytes == nil {
+			return errors.New("Error reading latest version of " + key)
+		}
+		var previous Version
+		err = json.Unmarshal(previousBytes, &previous)
+		if err != nil {
+			return errors.New("Error unmarshalling latest version of " + key)
+		}
+		version.Seq = previous.Seq + 1
+		if previous.TxID == version.TxID {
+			// Replace this transaction's earlier version
+			version.Seq = previous.Seq
+			logKey = string(previousKey)
+		}
+	}
+	if logKey == "" {
+		logKey = compositeKey(versionsByKey, key, padMillis(now), fmt.Sprintf("%010d", version.Seq))
+	}
+
+	versionBytes, err := json.Marshal(&version)
+	if err != nil {
+		fmt.Println("Error marshalling version of " + key)
+		return errors.New("Error marshalling version of " + key)
+	}
+	err = stub.PutState(logKey, versionBytes)
+	if err != nil {
+		fmt.Println("Error writing version of " + key)
+		return errors.New("Error writing version of " + key)
+	}
+	err = stub.PutState(latestKey, []byte(logKey))
+	if err != nil {
+		fmt.Println("Error writing latest version of " + key)
+		return errors.New("Error writing latest version of " + key)
+	}
+	return nil
+}
+
+// GetHistory returns the recorded versions of a property or account.
+// Versions written before the log existed aren't in it.
+func GetHistory(args string, stub StateStub) (HistoryPage, error) {
+	var page HistoryPage
+	var hq HistoryQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &hq)
+	if err != nil || (hq.CUSIP == "") == (hq.Account == "") {
+		return page, errors.New("GetHistory expects {\"cusip\": ...} or {\"account\": ...}")
+	}
+	key := ptyPrefix + hq.CUSIP
+	if hq.Account != "" {
+		key = accountPrefix + hq.Account
+	}
+	prefix := compositeKey(versionsByKey, key)
+
+	if hq.At != "" {
+		var found []byte
+		err = scanRange(stub, prefix, prefix+padMillis(hq.At)+"\x00\xff", func(key string, value []byte) error {
+			found = value
+			return nil
+		})
+		if err != nil {
+			return page, err
+		}
+		if found == nil {
+			return page, errors.New("No version of " + key + " recorded by " + hq.At)
+		}
+		var version Version
+		err = json.Unmarshal(found, &version)
+		if err != nil {
+			return page, errors.New("Error unmarshalling version of " + key)
+		}
+		page.Versions = append(page.Versions, version)
+		return page, nil
+	}
+
+	bookmark, err := pageIndex(stub, prefix, hq.PageQuery, func(indexKey string, value []byte) error {
+		var version Version
+		err := json.Unmarshal(value, &version)
+		if err != nil {
+			fmt.Println("Error unmarshalling version " + indexKey)
+			return errors.New("Error unmarshalling version of " + key)
+		}
+		page.Versions = append(page.Versions, version)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+	page.Bookmark = bookmark
+	return page, nil
+}
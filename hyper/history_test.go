@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func versionFunctions(page HistoryPage) []string {
+	var functions []string
+	for _, version := range page.Versions {
+		functions = append(functions, version.Function)
+	}
+	return functions
+}
+
+func TestGetHistory(t *testing.T) {
+	l := newTestLedger(t)
+	l.advance(time.Second)
+	cusip := l.setUp()
+	l.advance(time.Second)
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':30,'sellval':12.5}")
+	l.advance(time.Second)
+	sold := l.millis()
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':10}")
+	l.advance(time.Second)
+	l.invoke("admin", "grantRole", "{'id':'company2','role':'valuer'}")
+	l.invoke("company2", "updateMktVal", "{'cusip':'"+cusip+"','mktval':110000}")
+
+	var page HistoryPage
+	l.queryJSON(&page, "GetHistory", "{'cusip':'"+cusip+"'}")
+	want := []string{"issuePropertyToken", "approvePTY", "activatePTY", "setForSale", "transferPaper", "updateMktVal"}
+	if got := versionFunctions(page); !reflect.DeepEqual(got, want) {
+		t.Fatalf("property history is %v, want %v", got, want)
+	}
+	for i, version := range page.Versions {
+		if version.Seq != i+1 {
+			t.Errorf("version %d has seq %d", i+1, version.Seq)
+		}
+	}
+
+	// The version in force at a time is the last one written by then
+	var cp PTY
+	l.queryJSON(&page, "GetHistory", "{'cusip':'"+cusip+"','at':'"+sold+"'}")
+	json.Unmarshal(page.Versions[0].Value, &cp)
+	if owned, _ := holdingOf(cp, "company2"); len(page.Versions) != 1 || page.Versions[0].Function != "transferPaper" || owned != 10 || cp.MktValue != 10000000 {
+		t.Errorf("at the sale the property was %+v", page.Versions)
+	}
+	ms, _ := strconv.ParseInt(sold, 10, 64)
+	l.queryJSON(&page, "GetHistory", "{'cusip':'"+cusip+"','at':'"+strconv.FormatInt(ms-1, 10)+"'}")
+	cp = PTY{}
+	json.Unmarshal(page.Versions[0].Value, &cp)
+	if page.Versions[0].Function != "setForSale" || len(cp.PT4Sale) != 1 || cp.PT4Sale[0].Quantity != 30 {
+		t.Errorf("just before the sale the property was %+v", page.Versions)
+	}
+
+	// Bookmarks hold NUL separators, so the next query is built with
+	// json.Marshal
+	l.queryJSON(&page, "GetHistory", "{'account':'company2','limit':2}")
+	if got := versionFunctions(page); !reflect.DeepEqual(got, []string{"createAccounts", "transferPaper"}) || page.Bookmark == "" {
+		t.Fatalf("first page of company2's history is %v", got)
+	}
+	next, _ := json.Marshal(HistoryQuery{Account: "company2", PageQuery: PageQuery{Bookmark: page.Bookmark}})
+	page = HistoryPage{}
+	l.queryJSON(&page, "GetHistory", string(next))
+	if got := versionFunctions(page); !reflect.DeepEqual(got, []string{"grantRole"}) || page.Bookmark != "" {
+		t.Errorf("second page of company2's history is %v", got)
+	}
+
+	l.queryJSON(&page, "GetHistory", "{'account':'admin'}")
+	if page.Versions[0].Function != "init" {
+		t.Errorf("admin's history starts with %s", page.Versions[0].Function)
+	}
+
+	for _, args := range []string{
+		"{'account':'company2','cusip':'" + cusip + "'}",
+		"{}",
+		"{'account':'company2','at':'1'}",
+	} {
+		_, err := l.stub.MockQuery(l.cc, "query", []string{"GetHistory", args})
+		if err == nil {
+			t.Errorf("GetHistory %s should fail", args)
+		}
+	}
+}
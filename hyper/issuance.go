@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	corpActionIssue   = "issue"
+	corpActionBuyback = "buyback"
+)
+
+// Offering is an issue of new tokens of a property at a fixed price. New
+// tokens are only created as they are paid for. While a preemptive offering
+// is in its rights period each holder may take up to their pro-rata Rights,
+// and anyone may take what no right reserves; after it the rights lapse.
+type Offering struct {
+	OfferID     string  `json:"offerId"`
+	Quantity    int     `json:"quantity"`
+	Price       Money   `json:"price"`
+	Subscribed  int     `json:"subscribed"`
+	Preemptive  bool    `json:"preemptive"`
+	Rights      []Owner `json:"rights"`
+	RightsUntil string  `json:"rightsUntil"`
+	QtyBefore   int     `json:"qtyBefore"`
+	Opened      string  `json:"opened"`
+}
+
+type IssueTokens struct {
+	CUSIP       string `json:"cusip"`
+	Quantity    int    `json:"quantity"`
+	Price       Money  `json:"price"`
+	Preemptive  bool   `json:"preemptive"`
+	RightsUntil string `json:"rightsUntil"`
+}
+
+type SubscribeTokens struct {
+	CUSIP      string `json:"cusip"`
+	InvestorID string `json:"invid"`
+	Quantity   int    `json:"quantity"`
+}
+
+type CloseOffering struct {
+	CUSIP string `json:"cusip"`
+}
+
+type BuybackTokens struct {
+	CUSIP    string `json:"cusip"`
+	Quantity int    `json:"quantity"`
+	MaxPrice Money  `json:"maxPrice"`
+}
+
+// issueAdditionalTokens opens an offering of new tokens on a property. Only
+// its issuer can open one, and only one can be open at a time. A preemptive
+// offering reserves each holder's share of the new tokens, by quantity held,
+// until RightsUntil. The issuer's own share is not reserved.
+func (t *SimpleChaincode) issueAdditionalTokens(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting issue record")
+	}
+
+	var it IssueTokens
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &it)
+	if err != nil {
+		fmt.Println("Error Unmarshalling IssueTokens")
+		return nil, errors.New("Invalid issue record")
+	}
+	if it.Quantity <= 0 || it.Price <= 0 {
+		return nil, errors.New("An offering needs a positive quantity and price")
+	}
+
+	cp, err := GetPTY(it.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTradable(cp)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Offering != nil {
+		return nil, errors.New("Property " + cp.CUSIP + " already has offering " + cp.Offering.OfferID + " open")
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var offering Offering
+	offering.OfferID = stub.GetTxID()
+	offering.Quantity = it.Quantity
+	offering.Price = it.Price
+	offering.QtyBefore = cp.Qty
+	offering.Opened = now
+
+	if it.Preemptive {
+		if !millisBefore(now, it.RightsUntil) {
+			return nil, errors.New("A preemptive offering needs rightsUntil in the future")
+		}
+		offering.Preemptive = true
+		offering.RightsUntil = it.RightsUntil
+		offering.Rights = offeringRights(cp, it.Quantity)
+	}
+
+	cp.Offering = &offering
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Opened offering " + offering.OfferID + " of " + strconv.Itoa(it.Quantity) + " tokens of " + cp.CUSIP + " at " + it.Price.String())
+	return []byte(offering.OfferID), nil
+}
+
+// offeringRights gives each holder other than the issuer their share of
+// quantity new tokens by quantity held, rounded down.
+func offeringRights(cp PTY, quantity int) []Owner {
+	holders := holdersOf(cp)
+	held := 0
+	for _, holder := range holders {
+		held += holder.Quantity
+	}
+
+	var rights []Owner
+	for _, holder := range holders {
+		if holder.InvestorID == cp.Issuer {
+			continue
+		}
+		right := quantity * holder.Quantity / held
+		if right > 0 {
+			rights = append(rights, Owner{InvestorID: holder.InvestorID, Quantity: right})
+		}
+	}
+	return rights
+}
+
+// subscribeTokens buys new tokens from a property's open offering at the
+// offering price. The cash goes to the issuer and the tokens are created in
+// the subscriber's holding. The offering closes once it is fully taken up.
+func (t *SimpleChaincode) subscribeTokens(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting subscription record")
+	}
+
+	var st SubscribeTokens
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &st)
+	if err != nil {
+		fmt.Println("Error Unmarshalling SubscribeTokens")
+		return nil, errors.New("Invalid subscription record")
+	}
+	if st.Quantity <= 0 {
+		return nil, errors.New("Subscription quantity must be greater than zero")
+	}
+
+	buyer, err := requireCaller(stub, st.InvestorID, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := GetPTY(st.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTradable(cp)
+	if err != nil {
+		return nil, err
+	}
+	offering := cp.Offering
+	if offering == nil {
+		return nil, errors.New("Property " + cp.CUSIP + " has no open offering")
+	}
+	if buyer.ID == cp.Issuer {
+		return nil, errors.New("The issuer cannot subscribe to its own offering")
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	// Unreserved tokens are open to anyone; rights only count until they lapse
+	available := offering.Quantity - offering.Subscribed
+	right := -1
+	if offering.Preemptive && millisBefore(now, offering.RightsUntil) {
+		for key, r := range offering.Rights {
+			available -= r.Quantity
+			if r.InvestorID == buyer.ID {
+				right = key
+			}
+		}
+		if right != -1 {
+			available += offering.Rights[right].Quantity
+		}
+	}
+	if st.Quantity > available {
+		return nil, errors.New("Only " + strconv.Itoa(available) + " tokens of offering " + offering.OfferID + " are available to " + buyer.ID)
+	}
+
+	amount := offering.Price.MulInt(st.Quantity)
+	if buyer.CashBalance < amount {
+		fmt.Println("The company " + buyer.ID + " doesn't have enough cash to subscribe")
+		return nil, errors.New("The company " + buyer.ID + " doesn't have enough cash to subscribe")
+	}
+	buyer.CashBalance -= amount
+	err = putCompany(stub, buyer)
+	if err != nil {
+		return nil, err
+	}
+	issuer, err := GetCompany(cp.Issuer, stub)
+	if err != nil {
+		return nil, err
+	}
+	issuer.CashBalance += amount
+	err = putCompany(stub, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	// A holder's own right is used up first
+	if right != -1 {
+		used := st.Quantity
+		if offering.Rights[right].Quantity < used {
+			used = offering.Rights[right].Quantity
+		}
+		offering.Rights[right].Quantity -= used
+	}
+	addOwned(&cp, buyer.ID, st.Quantity)
+	cp.Qty += st.Quantity
+	offering.Subscribed += st.Quantity
+
+	_, err = recordTrade(stub, cp.CUSIP, cp.Issuer, buyer.ID, st.Quantity, offering.Price)
+	if err != nil {
+		return nil, err
+	}
+
+	if offering.Subscribed == offering.Quantity {
+		finishOffering(stub, &cp, now)
+	}
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println(buyer.ID + " subscribed for " + strconv.Itoa(st.Quantity) + " tokens of " + cp.CUSIP)
+	return nil, nil
+}
+
+// closeOffering ends a property's open offering early. The tokens already
+// subscribed stay issued; the rest are never created.
+func (t *SimpleChaincode) closeOffering(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting close record")
+	}
+
+	var co CloseOffering
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &co)
+	if err != nil {
+		fmt.Println("Error Unmarshalling CloseOffering")
+		return nil, errors.New("Invalid close record")
+	}
+
+	cp, err := GetPTY(co.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Offering == nil {
+		return nil, errors.New("Property " + cp.CUSIP + " has no open offering")
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+	finishOffering(stub, &cp, now)
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// finishOffering closes cp's offering in memory and records what was issued
+// in its corporate actions.
+func finishOffering(stub StateStub, cp *PTY, now string) {
+	offering := cp.Offering
+	cp.Offering = nil
+	if offering.Subscribed == 0 {
+		return
+	}
+
+	var action CorporateAction
+	action.Type = corpActionIssue
+	action.QtyBefore = offering.QtyBefore
+	action.QtyAfter = offering.QtyBefore + offering.Subscribed
+	action.Quantity = offering.Subscribed
+	action.Price = offering.Price
+	action.Amount = offering.Price.MulInt(offering.Subscribed)
+	action.TxID = stub.GetTxID()
+	action.Date = now
+	cp.CorporateActions = append(cp.CorporateActions, action)
+}
+
+// buybackTokens has the issuer buy back up to Quantity tokens listed for
+// sale at MaxPrice or less, cheapest first, and retire them. Each purchase is
+// settled and recorded as a trade; the issuer's own listings are skipped.
+func (t *SimpleChaincode) buybackTokens(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting buyback record")
+	}
+
+	var bt BuybackTokens
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &bt)
+	if err != nil {
+		fmt.Println("Error Unmarshalling BuybackTokens")
+		return nil, errors.New("Invalid buyback record")
+	}
+	if bt.Quantity <= 0 || bt.MaxPrice <= 0 {
+		return nil, errors.New("A buyback needs a positive quantity and maximum price")
+	}
+
+	cp, err := GetPTY(bt.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	// The issuer pays for the buyback out of its own account, so the admin
+	// can't run one for it
+	_, err = requireCaller(stub, cp.Issuer, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTradable(cp)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var action CorporateAction
+	action.Type = corpActionBuyback
+	action.QtyBefore = cp.Qty
+	action.Price = bt.MaxPrice
+	action.PaidBy = cp.Issuer
+	action.TxID = stub.GetTxID()
+	action.Date = now
+
+	for action.Quantity < bt.Quantity {
+		next := -1
+		for _, a := range askPriority(cp.PT4Sale) {
+			if cp.PT4Sale[a].InvestorID != cp.Issuer {
+				next = a
+				break
+			}
+		}
+		if next == -1 || cp.PT4Sale[next].SellVal > bt.MaxPrice {
+			break
+		}
+		ask := cp.PT4Sale[next]
+
+		quantity := bt.Quantity - action.Quantity
+		if ask.Quantity < quantity {
+			quantity = ask.Quantity
+		}
+		err = settleTrade(stub, &cp, ask.InvestorID, cp.Issuer, quantity, ask.SellVal)
+		if err != nil {
+			return nil, err
+		}
+		action.Quantity += quantity
+		action.Amount += ask.SellVal.MulInt(quantity)
+	}
+	if action.Quantity == 0 {
+		return nil, errors.New("No tokens of " + cp.CUSIP + " are listed at " + bt.MaxPrice.String() + " or less")
+	}
+
+	// settleTrade left the bought tokens with the issuer; retire them
+	addOwned(&cp, cp.Issuer, -action.Quantity)
+	cp.Qty -= action.Quantity
+	if cp.Qty <= 0 {
+		return nil, errors.New("A buyback can't retire every token of " + cp.CUSIP)
+	}
+	pruneHoldings(&cp)
+	action.QtyAfter = cp.Qty
+	cp.CorporateActions = append(cp.CorporateActions, action)
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Bought back " + strconv.Itoa(action.Quantity) + " tokens of " + cp.CUSIP + " for " + action.Amount.String())
+	return nil, nil
+}
+
+// addOwned adds quantity to investorID's owned entry on cp, in memory.
+func addOwned(cp *PTY, investorID string, quantity int) {
+	for key, owner := range cp.Owners {
+		if owner.InvestorID == investorID {
+			cp.Owners[key].Quantity += quantity
+			return
+		}
+	}
+	cp.Owners = append(cp.Owners, Owner{InvestorID: investorID, Quantity: quantity})
+}
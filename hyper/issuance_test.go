@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// holderTotal is the sum of every holder's owned plus listed tokens.
+func holderTotal(cp PTY) int {
+	total := 0
+	for _, holder := range holdersOf(cp) {
+		total += holder.Quantity
+	}
+	return total
+}
+
+func TestIssueAdditionalTokens(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':30}")
+	l.invoke("company3", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company3','quantity':20}")
+
+	rightsUntil := strconv.FormatInt(l.stub.TxTime.Add(time.Second).UnixNano()/nanosPerMillisecond, 10)
+	l.invokeErr("company2", "issueAdditionalTokens", "{'cusip':'"+cusip+"','quantity':50,'price':12}")
+	l.invoke("company1", "issueAdditionalTokens", "{'cusip':'"+cusip+"','quantity':50,'price':12,'preemptive':true,'rightsUntil':'"+rightsUntil+"'}")
+	cp := l.pty(cusip)
+	if cp.Offering == nil || len(cp.Offering.Rights) != 2 || cp.Offering.Rights[0].Quantity+cp.Offering.Rights[1].Quantity != 25 {
+		t.Fatalf("offering is %+v", cp.Offering)
+	}
+	l.invokeErr("company1", "splitTokens", "{'cusip':'"+cusip+"','ratio':2}")
+
+	// company2 can take its right of 15 plus the 25 no right reserves
+	l.invokeErr("company2", "subscribeTokens", "{'cusip':'"+cusip+"','invid':'company2','quantity':41}")
+	issuerCash, holderCash := l.cash("company1"), l.cash("company2")
+	l.invoke("company2", "subscribeTokens", "{'cusip':'"+cusip+"','invid':'company2','quantity':40}")
+	l.invokeErr("company4", "subscribeTokens", "{'cusip':'"+cusip+"','invid':'company4','quantity':1}")
+	cp = l.pty(cusip)
+	if owned, _ := holdingOf(cp, "company2"); cp.Qty != 140 || owned != 70 {
+		t.Fatalf("after subscribing there are %d tokens and company2 owns %d", cp.Qty, owned)
+	}
+	if l.cash("company1")-issuerCash != 48000 || holderCash-l.cash("company2") != 48000 {
+		t.Errorf("subscribing moved %s to company1", l.cash("company1")-issuerCash)
+	}
+
+	// company3's right lapses and company2 can take it
+	l.invokeErr("company2", "subscribeTokens", "{'cusip':'"+cusip+"','invid':'company2','quantity':1}")
+	l.advance(2 * time.Second)
+	l.invoke("company2", "subscribeTokens", "{'cusip':'"+cusip+"','invid':'company2','quantity':5}")
+	l.invoke("company1", "closeOffering", "{'cusip':'"+cusip+"'}")
+	cp = l.pty(cusip)
+	if cp.Offering != nil || cp.Qty != 145 || len(cp.CorporateActions) != 1 || cp.CorporateActions[0].Quantity != 45 || cp.CorporateActions[0].QtyAfter != 145 {
+		t.Errorf("after closing there are %d tokens and corporate actions %+v", cp.Qty, cp.CorporateActions)
+	}
+	l.verify()
+}
+
+func TestBuybackTokens(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':30}")
+	l.invoke("company3", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company3','quantity':20}")
+	l.invoke("company2", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company2','quantity':10,'sellval':11}")
+	l.invoke("company3", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company3','quantity':5,'sellval':9}")
+
+	// The issuer's cash pays for it, so the admin can't buy back for it
+	l.invokeErr("admin", "buybackTokens", "{'cusip':'"+cusip+"','quantity':12,'maxPrice':11}")
+	l.invokeErr("company1", "buybackTokens", "{'cusip':'"+cusip+"','quantity':12,'maxPrice':8}")
+
+	// 5 at 9 from company3 then 7 at 11 from company2; company1's own
+	// listing at 10 is skipped
+	issuerCash := l.cash("company1")
+	l.invoke("company1", "buybackTokens", "{'cusip':'"+cusip+"','quantity':12,'maxPrice':11}")
+	cp := l.pty(cusip)
+	if cp.Qty != 88 || holderTotal(cp) != 88 {
+		t.Fatalf("after the buyback there are %d tokens and holders have %d", cp.Qty, holderTotal(cp))
+	}
+	if got := issuerCash - l.cash("company1"); got != 5*900+7*1100 {
+		t.Errorf("company1 paid %s, want 122.00", got)
+	}
+	action := cp.CorporateActions[0]
+	if action.Type != corpActionBuyback || action.Quantity != 12 || action.Amount != 5*900+7*1100 || action.QtyBefore != 100 {
+		t.Errorf("buyback recorded as %+v", action)
+	}
+	l.verify()
+}
+
+func TestBuybackKeepsHolders(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':100}")
+	l.invoke("company2", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company2','quantity':100,'sellval':10}")
+
+	// Retiring all 100 would leave rent with no one to go to
+	l.invokeErr("company1", "buybackTokens", "{'cusip':'"+cusip+"','quantity':100,'maxPrice':10}")
+	l.invoke("company1", "buybackTokens", "{'cusip':'"+cusip+"','quantity':99,'maxPrice':10}")
+	if cp := l.pty(cusip); cp.Qty != 1 || holderTotal(cp) != 1 {
+		t.Errorf("after the buyback there are %d tokens and holders have %d", cp.Qty, holderTotal(cp))
+	}
+
+	_, _, err := creditHolders(l.stub, PTY{CUSIP: "empty"}, 100)
+	if err == nil {
+		t.Error("crediting a property with no holders should fail")
+	}
+	l.verify()
+}
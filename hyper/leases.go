@@ -0,0 +1,539 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var leasePrefix = "lease:"
+
+const (
+	leasePending    = "Pending"
+	leaseActive     = "Active"
+	leaseTerminated = "Terminated"
+)
+
+// Lease is a tenant's contract to rent a unit of a property. Active leases
+// are listed in the property's Renters and the tenant's Account.Leases. A
+// lease with a deposit is Pending until the tenant accepts it and pays the
+// deposit.
+type Lease struct {
+	LeaseID     string `json:"leaseId"`
+	CUSIP       string `json:"cusip"`
+	Tenant      string `json:"tenant"`
+	Unit        string `json:"unit"`
+	MonthlyRent Money  `json:"monthlyRent"`
+	Deposit     Money  `json:"deposit"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	Status      string `json:"status"`
+	Renewals    int    `json:"renewals"`
+	Created     string `json:"created"`
+	Terminated  string `json:"terminated"`
+	Reason      string `json:"reason"`
+
+	// Deposit held in escrow, and how it was settled when the lease ended
+	Escrow          Money  `json:"escrow"`
+	DepositReturned Money  `json:"depositReturned"`
+	DepositDeducted Money  `json:"depositDeducted"`
+	DeductionReason string `json:"deductionReason"`
+
+	// Billing state kept by accrueRent and processRent
+	PeriodsBilled int          `json:"periodsBilled"`
+	Charges       []RentCharge `json:"charges"`
+	Credit        Money        `json:"credit"`
+}
+
+type CreateLease struct {
+	CUSIP       string `json:"cusip"`
+	Tenant      string `json:"tenant"`
+	Unit        string `json:"unit"`
+	MonthlyRent Money  `json:"monthlyRent"`
+	Deposit     Money  `json:"deposit"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+}
+
+type AcceptLease struct {
+	LeaseID string `json:"leaseId"`
+}
+
+type RenewLease struct {
+	LeaseID     string `json:"leaseId"`
+	End         string `json:"end"`
+	MonthlyRent Money  `json:"monthlyRent"`
+}
+
+type TerminateLease struct {
+	LeaseID         string `json:"leaseId"`
+	Reason          string `json:"reason"`
+	Deduction       Money  `json:"deduction"`
+	DeductionReason string `json:"deductionReason"`
+}
+
+type LeaseQuery struct {
+	CUSIP  string `json:"cusip"`
+	Tenant string `json:"tenant"`
+	Status string `json:"status"`
+}
+
+// createLease lets a property's issuer sign a tenant up for a unit. If no
+// monthly rent is given the property's Rent is used. A lease without a
+// deposit starts straight away; one with a deposit waits for acceptLease,
+// since only the tenant can pay it.
+func (t *SimpleChaincode) createLease(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		fmt.Println("error invalid arguments")
+		return nil, errors.New("Incorrect number of arguments. Expecting lease record")
+	}
+
+	var cl CreateLease
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &cl)
+	if err != nil {
+		fmt.Println("error invalid lease")
+		return nil, errors.New("Invalid lease record")
+	}
+
+	cp, err := GetPTY(cl.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	err = checkRentable(cp)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant, err := GetCompany(cl.Tenant, stub)
+	if err != nil {
+		return nil, err
+	}
+	if !hasRole(tenant, roleRenter) {
+		return nil, errors.New("Account " + tenant.ID + " does not hold the renter role")
+	}
+
+	if cl.MonthlyRent == 0 {
+		cl.MonthlyRent = cp.Rent
+	}
+	if cl.MonthlyRent <= 0 || cl.Deposit < 0 {
+		return nil, errors.New("Lease rent must be positive and the deposit can't be negative")
+	}
+	err = checkLeaseTerm(cl.Start, cl.End)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkUnitFree(stub, cp, cl.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var lease Lease
+	lease.LeaseID, err = newRecordID(stub, leasePrefix)
+	if err != nil {
+		return nil, err
+	}
+	lease.CUSIP = cp.CUSIP
+	lease.Tenant = tenant.ID
+	lease.Unit = cl.Unit
+	lease.MonthlyRent = cl.MonthlyRent
+	lease.Deposit = cl.Deposit
+	lease.Start = cl.Start
+	lease.End = cl.End
+	lease.Status = leasePending
+	lease.Created = now
+
+	if lease.Deposit > 0 {
+		err = putLease(stub, lease)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Offered lease " + lease.LeaseID + " to " + tenant.ID + " on " + cp.CUSIP)
+		return []byte(lease.LeaseID), nil
+	}
+
+	err = startLease(stub, cp, tenant, lease)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(lease.LeaseID), nil
+}
+
+// acceptLease lets a tenant take up a Pending lease, paying its deposit into
+// escrow.
+func (t *SimpleChaincode) acceptLease(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		fmt.Println("error invalid arguments")
+		return nil, errors.New("Incorrect number of arguments. Expecting acceptance record")
+	}
+
+	var al AcceptLease
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &al)
+	if err != nil {
+		fmt.Println("error invalid acceptance")
+		return nil, errors.New("Invalid acceptance record")
+	}
+
+	lease, err := GetLease(al.LeaseID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if lease.Status != leasePending {
+		return nil, errors.New("Lease " + lease.LeaseID + " is " + lease.Status)
+	}
+
+	tenant, err := requireCaller(stub, lease.Tenant, roleRenter)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := GetPTY(lease.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = checkRentable(cp)
+	if err != nil {
+		return nil, err
+	}
+	// Another lease may have taken the unit since this one was offered
+	err = checkUnitFree(stub, cp, lease.Unit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = startLease(stub, cp, tenant, lease)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// startLease makes a Pending lease Active: it takes the deposit from the
+// tenant into escrow and adds the lease to the property's Renters and the
+// tenant's Leases.
+func startLease(stub StateStub, cp PTY, tenant Account, lease Lease) error {
+	err := holdDeposit(&tenant, &lease)
+	if err != nil {
+		return err
+	}
+	lease.Status = leaseActive
+
+	err = putLease(stub, lease)
+	if err != nil {
+		return err
+	}
+
+	cp.Renters = append(cp.Renters, Renter{RenterID: tenant.ID, LeaseID: lease.LeaseID})
+	err = putPTY(stub, cp)
+	if err != nil {
+		return err
+	}
+
+	tenant.Leases = append(tenant.Leases, lease.LeaseID)
+	err = putCompany(stub, tenant)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Started lease " + lease.LeaseID + " for " + tenant.ID + " on " + cp.CUSIP)
+	return nil
+}
+
+// checkUnitFree checks no active lease on cp is for unit.
+func checkUnitFree(stub StateStub, cp PTY, unit string) error {
+	for _, renter := range cp.Renters {
+		existing, err := GetLease(renter.LeaseID, stub)
+		if err != nil {
+			return err
+		}
+		if existing.Unit == unit {
+			return errors.New("Unit " + unit + " already has an active lease " + existing.LeaseID)
+		}
+	}
+	return nil
+}
+
+// renewLease extends an active lease to a later end date, optionally at a
+// new rent.
+func (t *SimpleChaincode) renewLease(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		fmt.Println("error invalid arguments")
+		return nil, errors.New("Incorrect number of arguments. Expecting renewal record")
+	}
+
+	var rl RenewLease
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &rl)
+	if err != nil {
+		fmt.Println("error invalid renewal")
+		return nil, errors.New("Invalid renewal record")
+	}
+
+	lease, err := GetLease(rl.LeaseID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if lease.Status != leaseActive {
+		return nil, errors.New("Lease " + lease.LeaseID + " is " + lease.Status)
+	}
+
+	cp, err := GetPTY(lease.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkLeaseTerm(lease.End, rl.End)
+	if err != nil {
+		return nil, errors.New("A renewal has to end after the current end date")
+	}
+	if rl.MonthlyRent < 0 {
+		return nil, errors.New("Lease rent can't be negative")
+	}
+
+	lease.End = rl.End
+	if rl.MonthlyRent > 0 {
+		lease.MonthlyRent = rl.MonthlyRent
+	}
+	lease.Renewals++
+
+	err = putLease(stub, lease)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// terminateLease ends a lease. Either the tenant or the property's issuer
+// can end it, and ending a Pending lease withdraws or declines the offer.
+func (t *SimpleChaincode) terminateLease(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		fmt.Println("error invalid arguments")
+		return nil, errors.New("Incorrect number of arguments. Expecting termination record")
+	}
+
+	var tl TerminateLease
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &tl)
+	if err != nil {
+		fmt.Println("error invalid termination")
+		return nil, errors.New("Invalid termination record")
+	}
+
+	lease, err := GetLease(tl.LeaseID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if lease.Status != leaseActive && lease.Status != leasePending {
+		return nil, errors.New("Lease " + lease.LeaseID + " is " + lease.Status)
+	}
+
+	cp, err := GetPTY(lease.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	if caller.ID != lease.Tenant {
+		err = requirePropertyIssuer(stub, cp)
+		if err != nil {
+			return nil, errors.New("Only the tenant or the issuer can end lease " + lease.LeaseID)
+		}
+	}
+	if tl.Deduction != 0 {
+		err = requirePropertyIssuer(stub, cp)
+		if err != nil {
+			return nil, errors.New("Only the issuer can deduct from the deposit on lease " + lease.LeaseID)
+		}
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	err = closeLease(stub, &cp, lease, now, tl)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// closeLease marks a lease terminated, takes it off the property's Renters
+// and the tenant's Leases, and releases the deposit less any deduction in tl.
+// cp is only changed in memory; the lease and accounts are written here.
+func closeLease(stub StateStub, cp *PTY, lease Lease, when string, tl TerminateLease) error {
+	lease.Status = leaseTerminated
+	lease.Terminated = when
+	lease.Reason = tl.Reason
+
+	var renters []Renter
+	for _, renter := range cp.Renters {
+		if renter.LeaseID != lease.LeaseID {
+			renters = append(renters, renter)
+		}
+	}
+	cp.Renters = renters
+
+	tenant, err := GetCompany(lease.Tenant, stub)
+	if err != nil {
+		return err
+	}
+	var leases []string
+	for _, leaseID := range tenant.Leases {
+		if leaseID != lease.LeaseID {
+			leases = append(leases, leaseID)
+		}
+	}
+	tenant.Leases = leases
+
+	err = releaseDeposit(&tenant, &lease, tl.Deduction, tl.DeductionReason)
+	if err != nil {
+		return err
+	}
+	err = putLease(stub, lease)
+	if err != nil {
+		return err
+	}
+	// The tenant is written before the holders are paid in case the tenant
+	// is also a holder
+	err = putCompany(stub, tenant)
+	if err != nil {
+		return err
+	}
+	if lease.DepositDeducted > 0 {
+		_, _, err = creditHolders(stub, *cp, lease.DepositDeducted)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("Terminated lease " + lease.LeaseID)
+	return nil
+}
+
+// requirePropertyIssuer checks the caller issued cp, or is the admin.
+func requirePropertyIssuer(stub StateStub, cp PTY) error {
+	caller, err := requireRole(stub, roleIssuer)
+	if err != nil {
+		return err
+	}
+	if caller.ID != cp.Issuer && !hasRole(caller, roleAdmin) {
+		return errors.New("Only the issuer of " + cp.CUSIP + " can do that")
+	}
+	return nil
+}
+
+// checkLeaseTerm checks start and end are millisecond timestamps with end
+// after start.
+func checkLeaseTerm(start string, end string) error {
+	startMs, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return errors.New("Lease start must be a timestamp in milliseconds")
+	}
+	endMs, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return errors.New("Lease end must be a timestamp in milliseconds")
+	}
+	if endMs <= startMs {
+		return errors.New("Lease end must be after its start")
+	}
+	return nil
+}
+
+// findLease returns the tenant's active lease on cp. leaseID picks one when
+// the tenant rents more than one unit of the property.
+func findLease(stub StateStub, cp PTY, tenant string, leaseID string) (Lease, error) {
+	var found []string
+	for _, renter := range cp.Renters {
+		if renter.RenterID == tenant && (leaseID == "" || renter.LeaseID == leaseID) {
+			found = append(found, renter.LeaseID)
+		}
+	}
+	if len(found) == 0 {
+		return Lease{}, errors.New(tenant + " has no active lease on " + cp.CUSIP)
+	}
+	if len(found) > 1 {
+		return Lease{}, errors.New(tenant + " has several leases on " + cp.CUSIP + ", pass a leaseId")
+	}
+	return GetLease(found[0], stub)
+}
+
+func putLease(stub StateStub, lease Lease) error {
+	leaseBytes, err := json.Marshal(&lease)
+	if err != nil {
+		fmt.Println("Error marshalling lease " + lease.LeaseID)
+		return errors.New("Error marshalling lease " + lease.LeaseID)
+	}
+	err = stub.PutState(leasePrefix+lease.LeaseID, leaseBytes)
+	if err != nil {
+		fmt.Println("Error writing lease " + lease.LeaseID)
+		return errors.New("Error writing lease " + lease.LeaseID)
+	}
+	return nil
+}
+
+func GetLease(leaseID string, stub StateStub) (Lease, error) {
+	var lease Lease
+	leaseBytes, err := stub.GetState(leasePrefix + leaseID)
+	if err != nil || leaseBytes == nil {
+		fmt.Println("Lease not found " + leaseID)
+		return lease, errors.New("Lease not found " + leaseID)
+	}
+	err = json.Unmarshal(leaseBytes, &lease)
+	if err != nil {
+		fmt.Println("Error unmarshalling lease " + leaseID)
+		return lease, errors.New("Error unmarshalling lease " + leaseID)
+	}
+	return lease, nil
+}
+
+// GetLeases lists leases, filtered by any of property, tenant and status.
+func GetLeases(args string, stub StateStub) ([]Lease, error) {
+	var lq LeaseQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &lq)
+	if err != nil {
+		return nil, errors.New("Invalid lease query")
+	}
+
+	var leases []Lease
+	err = scanPrefix(stub, leasePrefix, func(key string, value []byte) error {
+		var lease Lease
+		err := json.Unmarshal(value, &lease)
+		if err != nil {
+			return errors.New("Error unmarshalling lease " + key)
+		}
+		if lq.CUSIP != "" && lease.CUSIP != lq.CUSIP {
+			return nil
+		}
+		if lq.Tenant != "" && lease.Tenant != lq.Tenant {
+			return nil
+		}
+		if lq.Status != "" && lease.Status != lq.Status {
+			return nil
+		}
+		leases = append(leases, lease)
+		return nil
+	})
+	return leases, err
+}
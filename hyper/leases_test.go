@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestLeaseDeposit(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	lease := func(unit string, deposit string) string {
+		l.t.Helper()
+		return string(l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'"+unit+"','monthlyRent':1000,'deposit':"+deposit+",'start':'0','end':'31536000000'}"))
+	}
+
+	// Offering a lease with a deposit takes nothing from the tenant
+	offered := lease("1A", "500")
+	if got := l.cash("company4"); got != defaultCashBalance {
+		t.Fatalf("company4 has %s before accepting", got)
+	}
+	var pending Lease
+	l.queryJSON(&pending, "GetLease", offered)
+	if pending.Status != leasePending || len(l.pty(cusip).Renters) != 0 {
+		t.Fatalf("offered lease is %s with renters %+v", pending.Status, l.pty(cusip).Renters)
+	}
+	l.invokeErr("company1", "acceptLease", "{'leaseId':'"+offered+"'}")
+	l.invokeErr("admin", "acceptLease", "{'leaseId':'"+offered+"'}")
+	l.invokeErr("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4'}")
+
+	// The unit isn't held for the offer
+	other := lease("1A", "0")
+	l.invokeErr("company4", "acceptLease", "{'leaseId':'"+offered+"'}")
+	l.invoke("company4", "terminateLease", "{'leaseId':'"+other+"'}")
+
+	l.invoke("company4", "acceptLease", "{'leaseId':'"+offered+"'}")
+	l.invokeErr("company4", "acceptLease", "{'leaseId':'"+offered+"'}")
+	if account := l.account("company4"); account.CashBalance != defaultCashBalance-50000 || account.Escrow != 50000 {
+		t.Fatalf("company4 has %s cash and %s in escrow after accepting", account.CashBalance, account.Escrow)
+	}
+	var escrow EscrowReport
+	l.queryJSON(&escrow, "GetEscrow", "{'tenant':'company4'}")
+	if escrow.Held != 50000 {
+		t.Errorf("escrow holds %s, want 500.00", escrow.Held)
+	}
+
+	// The issuer keeps 150 for the holders and the rest goes back
+	l.invokeErr("company4", "terminateLease", "{'leaseId':'"+offered+"','deduction':150}")
+	l.invoke("company1", "terminateLease", "{'leaseId':'"+offered+"','deduction':150,'deductionReason':'repairs'}")
+	if account := l.account("company4"); account.CashBalance != defaultCashBalance-15000 || account.Escrow != 0 {
+		t.Errorf("company4 has %s cash and %s in escrow after the lease ended", account.CashBalance, account.Escrow)
+	}
+	if got := l.cash("company1"); got != defaultCashBalance+15000 {
+		t.Errorf("company1 has %s, want 150.00 more", got)
+	}
+
+	// A tenant can turn an offer down
+	declined := lease("2B", "500")
+	l.invoke("company4", "terminateLease", "{'leaseId':'"+declined+"','reason':'declined'}")
+	l.invokeErr("company4", "acceptLease", "{'leaseId':'"+declined+"'}")
+	if got := l.cash("company4"); got != defaultCashBalance-15000 {
+		t.Errorf("company4 has %s after declining", got)
+	}
+	l.verify()
+}
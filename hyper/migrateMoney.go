@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// migrateMoney rewrites every account and property so amounts stored as
+// float64 by earlier versions of the chaincode are saved as whole cents.
+// Loading through Money already rounds the old values, so this just has to
+// read and write everything back.
+func (t *SimpleChaincode) migrateMoney(stub StateStub, args []string) ([]byte, error) {
+	_, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts := 0
+	err = scanPrefix(stub, accountPrefix, func(key string, value []byte) error {
+		var account Account
+		err := json.Unmarshal(value, &account)
+		if err != nil {
+			fmt.Println("Error unmarshalling account " + key)
+			return errors.New("Error unmarshalling account " + key)
+		}
+		accountBytes, err := json.Marshal(&account)
+		if err != nil {
+			fmt.Println("Error marshalling account " + key)
+			return errors.New("Error marshalling account " + key)
+		}
+		accounts++
+		return stub.PutState(key, accountBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	properties := 0
+	err = scanPrefix(stub, ptyPrefix, func(key string, value []byte) error {
+		var cp PTY
+		err := json.Unmarshal(value, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling cp " + key)
+			return errors.New("Error unmarshalling cp " + key)
+		}
+		cpBytes, err := json.Marshal(&cp)
+		if err != nil {
+			fmt.Println("Error marshalling cp " + key)
+			return errors.New("Error marshalling cp " + key)
+		}
+		properties++
+		return stub.PutState(key, cpBytes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Migrated %d accounts and %d properties to cents\n", accounts, properties)
+	return nil, nil
+}
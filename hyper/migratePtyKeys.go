@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ptyKeysKey is the JSON array of property keys earlier versions of the
+// chaincode rewrote on every issuance. Properties are now found with range
+// scans over ptyPrefix instead.
+const ptyKeysKey = "PtyKeys"
+
+// migratePtyKeys retires the PtyKeys array. Every property it lists is
+// checked to be stored under ptyPrefix+CUSIP, where range scans find it, and
+// moved there if it was stored under another key. The array is then deleted.
+func (t *SimpleChaincode) migratePtyKeys(stub StateStub, args []string) ([]byte, error) {
+	_, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	keysBytes, err := stub.GetState(ptyKeysKey)
+	if err != nil {
+		return nil, errors.New("Error reading " + ptyKeysKey)
+	}
+	if keysBytes == nil {
+		fmt.Println("No " + ptyKeysKey + " to migrate")
+		return nil, nil
+	}
+	var keys []string
+	err = json.Unmarshal(keysBytes, &keys)
+	if err != nil {
+		fmt.Println("Error unmarshalling " + ptyKeysKey)
+		return nil, errors.New("Error unmarshalling " + ptyKeysKey)
+	}
+
+	moved := 0
+	for _, key := range keys {
+		cpBytes, err := stub.GetState(key)
+		if err != nil || cpBytes == nil {
+			fmt.Println("Skipping missing property " + key)
+			continue
+		}
+		var cp PTY
+		err = json.Unmarshal(cpBytes, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling cp " + key)
+			return nil, errors.New("Error unmarshalling cp " + key)
+		}
+		if key == ptyPrefix+cp.CUSIP {
+			continue
+		}
+
+		existing, err := stub.GetState(ptyPrefix + cp.CUSIP)
+		if err != nil {
+			return nil, errors.New("Error reading cp " + cp.CUSIP)
+		}
+		if existing != nil {
+			return nil, errors.New("Property " + cp.CUSIP + " is stored under both " + key + " and " + ptyPrefix + cp.CUSIP)
+		}
+		err = putPTY(stub, cp)
+		if err != nil {
+			return nil, err
+		}
+		err = stub.DelState(key)
+		if err != nil {
+			return nil, errors.New("Error deleting " + key)
+		}
+		moved++
+	}
+
+	err = stub.DelState(ptyKeysKey)
+	if err != nil {
+		return nil, errors.New("Error deleting " + ptyKeysKey)
+	}
+
+	fmt.Printf("Migrated %d property keys, moved %d properties\n", len(keys), moved)
+	return nil, nil
+}
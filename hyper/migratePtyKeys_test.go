@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMigratePtyKeys(t *testing.T) {
+	l := newTestLedger(t)
+	first := l.setUp()
+	second := l.issue("company1", "2 Main St", 50)
+
+	// Older versions stored the second property under its bare CUSIP and
+	// listed every key in PtyKeys, including one that has since gone
+	legacy, _ := l.stub.GetState(ptyPrefix + second)
+	l.stub.PutState(second, legacy)
+	l.stub.DelState(ptyPrefix + second)
+	l.putJSON(ptyKeysKey, []string{ptyPrefix + first, second, ptyPrefix + "gone"})
+
+	l.invokeErr("company1", "migratePtyKeys")
+	l.invoke("admin", "migratePtyKeys")
+
+	if moved, _ := l.stub.GetState(ptyPrefix + second); moved == nil {
+		t.Fatal("the second property wasn't moved under " + ptyPrefix)
+	}
+	if old, _ := l.stub.GetState(second); old != nil {
+		t.Error("the second property is still under its old key")
+	}
+	if keys, _ := l.stub.GetState(ptyKeysKey); keys != nil {
+		t.Errorf("%s is still %s", ptyKeysKey, keys)
+	}
+	if cp := l.pty(second); cp.Qty != 50 || cp.Status != statusActive {
+		t.Errorf("moved property is %+v", cp)
+	}
+	var all []PTY
+	l.queryJSON(&all, "GetAllPTYs")
+	if len(all) != 2 {
+		t.Errorf("GetAllPTYs returned %d properties", len(all))
+	}
+	l.verify()
+
+	before := l.stub.snapshot()
+	l.invoke("admin", "migratePtyKeys")
+	if !reflect.DeepEqual(before, l.stub.State) {
+		t.Error("a second run changed the ledger")
+	}
+
+	// A property stored under both keys is left for someone to look at
+	l.stub.PutState(second, legacy)
+	l.putJSON(ptyKeysKey, []string{second})
+	l.invokeErr("admin", "migratePtyKeys")
+}
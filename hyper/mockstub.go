@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// MemStub is an in-memory StateStub. It keeps world state in a map and mimics
+// the peer closely enough to run invokes and queries end to end: an invoke
+// that returns an error has all of its writes rolled back, the same way the
+// peer discards the read/write set of a failed transaction.
+//
+// Every invoke gets a fresh TxID. TxTime is the transaction timestamp and is
+// left to the caller, so a test can move the clock between invokes.
+// CertAttributes stands in for the attributes on the caller's certificate;
+// SetCaller fills in the account attribute.
+type MemStub struct {
+	State          map[string][]byte
+	TxID           string
+	TxTime         time.Time
+	CertAttributes map[string][]byte
+
+	txCount int
+}
+
+func NewMemStub() *MemStub {
+	return &MemStub{
+		State:          make(map[string][]byte),
+		TxTime:         time.Unix(0, 0).UTC(),
+		CertAttributes: make(map[string][]byte),
+	}
+}
+
+// SetCaller makes later invokes run as the given account.
+func (s *MemStub) SetCaller(id string) {
+	s.CertAttributes[callerAttribute] = []byte(id)
+}
+
+func (s *MemStub) GetState(key string) ([]byte, error) {
+	value, ok := s.State[key]
+	if !ok {
+		return nil, nil
+	}
+	return value, nil
+}
+
+func (s *MemStub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("Key cannot be blank")
+	}
+	s.State[key] = value
+	return nil
+}
+
+func (s *MemStub) GetTxID() string {
+	return s.TxID
+}
+
+func (s *MemStub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.TxTime.Unix(), Nanos: int32(s.TxTime.Nanosecond())}, nil
+}
+
+func (s *MemStub) ReadCertAttribute(attributeName string) ([]byte, error) {
+	value, ok := s.CertAttributes[attributeName]
+	if !ok {
+		return nil, errors.New("Attribute " + attributeName + " not found")
+	}
+	return value, nil
+}
+
+func (s *MemStub) DelState(key string) error {
+	delete(s.State, key)
+	return nil
+}
+
+// RangeQueryState returns the keys between startKey and endKey inclusive in
+// lexical order, matching the peer's range query.
+func (s *MemStub) RangeQueryState(startKey, endKey string) (shim.StateRangeQueryIteratorInterface, error) {
+	var keys []string
+	for key := range s.State {
+		if key >= startKey && key <= endKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	iter := &memStateIterator{}
+	for _, key := range keys {
+		iter.keys = append(iter.keys, key)
+		iter.values = append(iter.values, s.State[key])
+	}
+	return iter, nil
+}
+
+// MockInit runs Init against the stub, rolling back on error.
+func (s *MemStub) MockInit(t *SimpleChaincode, function string, args []string) ([]byte, error) {
+	return s.transact(func() ([]byte, error) {
+		return t.init(s, function, args)
+	})
+}
+
+// MockInvoke runs a single invoke against the stub, rolling back on error.
+func (s *MemStub) MockInvoke(t *SimpleChaincode, function string, args []string) ([]byte, error) {
+	return s.transact(func() ([]byte, error) {
+		return t.invoke(s, function, args)
+	})
+}
+
+// MockQuery runs a query against the stub. Any writes a query makes are
+// discarded, since the peer never commits state from a query.
+func (s *MemStub) MockQuery(t *SimpleChaincode, function string, args []string) ([]byte, error) {
+	snapshot := s.snapshot()
+	defer func() { s.State = snapshot }()
+	return t.query(s, function, args)
+}
+
+func (s *MemStub) transact(run func() ([]byte, error)) ([]byte, error) {
+	s.txCount++
+	s.TxID = fmt.Sprintf("memtx%d", s.txCount)
+	snapshot := s.snapshot()
+	result, err := run()
+	if err != nil {
+		fmt.Println("Rolling back failed transaction: " + err.Error())
+		s.State = snapshot
+		return nil, err
+	}
+	return result, nil
+}
+
+func (s *MemStub) snapshot() map[string][]byte {
+	copied := make(map[string][]byte, len(s.State))
+	for key, value := range s.State {
+		copied[key] = value
+	}
+	return copied
+}
+
+type memStateIterator struct {
+	keys   []string
+	values [][]byte
+	pos    int
+}
+
+func (it *memStateIterator) HasNext() bool {
+	return it.pos < len(it.keys)
+}
+
+func (it *memStateIterator) Next() (string, []byte, error) {
+	if !it.HasNext() {
+		return "", nil, errors.New("Iterator exhausted")
+	}
+	key, value := it.keys[it.pos], it.values[it.pos]
+	it.pos++
+	return key, value, nil
+}
+
+func (it *memStateIterator) Close() error {
+	it.pos = len(it.keys)
+	return nil
+}
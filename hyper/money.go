@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Money is an amount of cash held as a whole number of cents, so balances
+// and prices never pick up the fractional drift float64 arithmetic gives.
+//
+// Rounding rules:
+//   - Amounts parsed from JSON or text with more than two decimal places are
+//     rounded to the nearest cent, halves away from zero.
+//   - Div rounds the same way.
+//   - Allocate never rounds: the parts always add back up to the total, with
+//     leftover cents going to the largest remainders.
+type Money int64
+
+const centsPerUnit = 100
+
+var defaultCashBalance = Money(10000000 * centsPerUnit)
+
+// ParseMoney reads a decimal amount such as "12.5", "-3" or "1.0001025e+07".
+// Exponent notation is accepted so float balances written by earlier versions
+// of the chaincode still load.
+func ParseMoney(text string) (Money, error) {
+	text = strings.TrimSpace(text)
+	amount, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return 0, errors.New("Invalid money amount " + text)
+	}
+	amount.Mul(amount, big.NewRat(centsPerUnit, 1))
+	cents := roundRat(amount)
+	if !cents.IsInt64() {
+		return 0, errors.New("Money amount out of range " + text)
+	}
+	return Money(cents.Int64()), nil
+}
+
+// roundRat rounds to the nearest integer, halves away from zero.
+func roundRat(r *big.Rat) *big.Int {
+	num := new(big.Int).Abs(r.Num())
+	den := r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	return quo
+}
+
+// MulInt returns the amount multiplied by a token quantity.
+func (m Money) MulInt(n int) Money {
+	return m * Money(n)
+}
+
+// Div divides the amount by n, rounding to the nearest cent.
+func (m Money) Div(n int) Money {
+	if n == 0 {
+		return 0
+	}
+	return Money(roundRat(big.NewRat(int64(m), int64(n))).Int64())
+}
+
+// Allocate splits the amount across weights (usually token quantities) in
+// proportion. Every part is rounded down to the cent and the cents left over
+// go one at a time to the largest remainders, earliest weight first on ties,
+// so the parts always sum to the original amount.
+func (m Money) Allocate(weights []int) []Money {
+	parts := make([]Money, len(weights))
+	total := 0
+	for _, w := range weights {
+		if w > 0 {
+			total += w
+		}
+	}
+	if total == 0 {
+		return parts
+	}
+
+	sign := Money(1)
+	amount := m
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	remainders := make([]int64, len(weights))
+	allocated := Money(0)
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+		share := int64(amount) * int64(w)
+		parts[i] = Money(share / int64(total))
+		remainders[i] = share % int64(total)
+		allocated += parts[i]
+	}
+
+	for left := amount - allocated; left > 0; left-- {
+		best := -1
+		for i, w := range weights {
+			if w <= 0 {
+				continue
+			}
+			if best == -1 || remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		parts[best]++
+		remainders[best] = -1
+	}
+
+	for i := range parts {
+		parts[i] *= sign
+	}
+	return parts
+}
+
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/centsPerUnit, cents%centsPerUnit)
+}
+
+// MarshalJSON writes the amount as a JSON number with exactly two decimals,
+// e.g. 12.50, which reads back to the same number of cents.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, "\"") {
+		var quoted string
+		err := json.Unmarshal(data, &quoted)
+		if err != nil {
+			return err
+		}
+		text = quoted
+	}
+	amount, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
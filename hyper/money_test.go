@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		text string
+		want Money
+	}{
+		{"12.5", 1250},
+		{"-3", -300},
+		{"0.005", 1},
+		{"-0.005", -1},
+		{"0.0049", 0},
+		{"1.0001025e+07", 1000102500},
+		{" 7 ", 700},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.text)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+	}
+	for _, text := range []string{"", "ten", "1e30"} {
+		if _, err := ParseMoney(text); err == nil {
+			t.Errorf("ParseMoney(%q) should fail", text)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Money
+	}{
+		{`12.5`, 1250},
+		{`"3.10"`, 310},
+		{`1e+07`, 1000000000},
+		{`-0.01`, -1},
+	}
+	for _, tt := range tests {
+		var m Money
+		err := json.Unmarshal([]byte(tt.json), &m)
+		if err != nil || m != tt.want {
+			t.Errorf("unmarshal %s = %d, %v, want %d", tt.json, m, err, tt.want)
+			continue
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Money
+		if json.Unmarshal(data, &back) != nil || back != m {
+			t.Errorf("%d written as %s reads back as %d", m, data, back)
+		}
+	}
+	if got := Money(-5).String(); got != "-0.05" {
+		t.Errorf("String() = %s, want -0.05", got)
+	}
+}
+
+func TestMoneyDiv(t *testing.T) {
+	tests := []struct {
+		m    Money
+		n    int
+		want Money
+	}{
+		{1001, 2, 501},
+		{-1001, 2, -501},
+		{1000, 3, 333},
+		{2000, 3, 667},
+		{100, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Div(tt.n); got != tt.want {
+			t.Errorf("%d.Div(%d) = %d, want %d", tt.m, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       Money
+		weights []int
+		want    []Money
+	}{
+		{"even split", 900, []int{1, 1, 1}, []Money{300, 300, 300}},
+		{"leftover cent goes to the earliest tie", 1000, []int{1, 1, 1}, []Money{334, 333, 333}},
+		{"leftover cents go to the largest remainders", 100, []int{1, 2, 4}, []Money{14, 29, 57}},
+		{"by token quantity", 100001, []int{75, 20, 5}, []Money{75001, 20000, 5000}},
+		{"zero and negative weights get nothing", 1000, []int{1, 0, -3, 1}, []Money{500, 0, 0, 500}},
+		{"negative amounts split the same way", -1000, []int{1, 0, 2}, []Money{-333, 0, -667}},
+		{"no weights", 1000, []int{0, 0}, []Money{0, 0}},
+		{"fewer cents than weights", 2, []int{1, 1, 1}, []Money{1, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.m.Allocate(tt.weights)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%d.Allocate(%v) = %v, want %v", tt.m, tt.weights, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrateMoney(t *testing.T) {
+	l := newTestLedger(t)
+	l.stub.State[accountPrefix+"old"] = []byte(`{"id":"old","cashBalance":1.0001025e+07}`)
+	l.stub.State[ptyPrefix+"x"] = []byte(`{"cusip":"x","mktval":10.333,"rent":1000.1}`)
+	l.invoke("admin", "migrateMoney")
+
+	var account map[string]interface{}
+	json.Unmarshal(l.stub.State[accountPrefix+"old"], &account)
+	if account["cashBalance"] != 10001025.0 {
+		t.Errorf("cashBalance migrated to %v", account["cashBalance"])
+	}
+	cp := l.pty("x")
+	if cp.MktValue != 1033 || cp.Rent != 100010 {
+		t.Errorf("property migrated to mktval %s and rent %s", cp.MktValue, cp.Rent)
+	}
+}
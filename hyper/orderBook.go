@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Bid is a resting buy order for a property's tokens. Bids sit on the PTY
+// next to the PT4Sale asks; Seq gives both sides their time priority.
+type Bid struct {
+	Seq        int    `json:"seq"`
+	InvestorID string `json:"invid"`
+	Quantity   int    `json:"quantity"`
+	LimitPrice Money  `json:"limitPrice"`
+	Placed     string `json:"placed"`
+}
+
+type PlaceBid struct {
+	CUSIP      string `json:"cusip"`
+	InvestorID string `json:"invid"`
+	Quantity   int    `json:"quantity"`
+	LimitPrice Money  `json:"limitPrice"`
+}
+
+type CancelBid struct {
+	CUSIP      string `json:"cusip"`
+	InvestorID string `json:"invid"`
+	Seq        int    `json:"seq"`
+}
+
+// OrderBook is both sides of a property's market, best price first.
+type OrderBook struct {
+	CUSIP string    `json:"cusip"`
+	Bids  []Bid     `json:"bids"`
+	Asks  []ForSale `json:"asks"`
+}
+
+func nextOrderSeq(cp *PTY) int {
+	cp.OrderSeq++
+	return cp.OrderSeq
+}
+
+// placeBid posts a buy order and matches it against the asks straight away.
+// Whatever doesn't fill rests in the book.
+func (t *SimpleChaincode) placeBid(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting bid record")
+	}
+
+	var pb PlaceBid
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &pb)
+	if err != nil {
+		fmt.Println("Error Unmarshalling PlaceBid")
+		return nil, errors.New("Invalid bid record")
+	}
+
+	buyer, err := requireCaller(stub, pb.InvestorID, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if pb.Quantity <= 0 || pb.LimitPrice <= 0 {
+		return nil, errors.New("Bids need a positive quantity and limit price")
+	}
+	if buyer.CashBalance < pb.LimitPrice.MulInt(pb.Quantity) {
+		fmt.Println("The company " + buyer.ID + " doesn't have enough cash to cover the bid")
+		return nil, errors.New("The company " + buyer.ID + " doesn't have enough cash to cover the bid")
+	}
+
+	cp, err := GetPTY(pb.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTradable(cp)
+	if err != nil {
+		return nil, err
+	}
+
+	placed, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var bid Bid
+	bid.Seq = nextOrderSeq(&cp)
+	bid.InvestorID = pb.InvestorID
+	bid.Quantity = pb.Quantity
+	bid.LimitPrice = pb.LimitPrice
+	bid.Placed = placed
+	cp.Bids = append(cp.Bids, bid)
+
+	err = matchOrders(stub, &cp)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Successfully completed Invoke")
+	return nil, nil
+}
+
+// cancelBid removes the rest of a bid from the book. Bids can be cancelled
+// whatever the property's status.
+func (t *SimpleChaincode) cancelBid(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting cancel record")
+	}
+
+	var cb CancelBid
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &cb)
+	if err != nil {
+		fmt.Println("Error Unmarshalling CancelBid")
+		return nil, errors.New("Invalid cancel record")
+	}
+
+	_, err = requireCaller(stub, cb.InvestorID, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := GetPTY(cb.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	found := false
+	var bids []Bid
+	for _, bid := range cp.Bids {
+		if bid.Seq == cb.Seq && bid.InvestorID == cb.InvestorID {
+			found = true
+			continue
+		}
+		bids = append(bids, bid)
+	}
+	if !found {
+		return nil, errors.New("No open bid " + fmt.Sprint(cb.Seq) + " from " + cb.InvestorID)
+	}
+	cp.Bids = bids
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// matchOrders fills crossing bids and asks with price-time priority until
+// the book no longer crosses. The highest bid meets the lowest ask, earlier
+// orders first at the same price, and each fill trades at the price of
+// whichever order was resting in the book first. A holder's bid never fills
+// against their own ask. A bid whose buyer can no longer pay is dropped.
+// cp is updated in memory and the accounts are settled through settleTrade.
+func matchOrders(stub StateStub, cp *PTY) error {
+	for {
+		bidKey, askKey := bestCross(cp)
+		if bidKey == -1 {
+			break
+		}
+		bid := cp.Bids[bidKey]
+		ask := cp.PT4Sale[askKey]
+
+		quantity := bid.Quantity
+		if ask.Quantity < quantity {
+			quantity = ask.Quantity
+		}
+		price := ask.SellVal
+		if bid.Seq < ask.Seq {
+			price = bid.LimitPrice
+		}
+
+		buyer, err := GetCompany(bid.InvestorID, stub)
+		if err != nil {
+			return err
+		}
+		if buyer.CashBalance < price.MulInt(quantity) {
+			fmt.Println("Dropping unfunded bid from " + bid.InvestorID)
+			cp.Bids = append(cp.Bids[:bidKey], cp.Bids[bidKey+1:]...)
+			continue
+		}
+
+		fmt.Printf("Matched bid %d against ask %d: %d at %s\n", bid.Seq, ask.Seq, quantity, price)
+		err = settleTrade(stub, cp, ask.InvestorID, bid.InvestorID, quantity, price)
+		if err != nil {
+			return err
+		}
+
+		cp.Bids[bidKey].Quantity -= quantity
+		if cp.Bids[bidKey].Quantity == 0 {
+			cp.Bids = append(cp.Bids[:bidKey], cp.Bids[bidKey+1:]...)
+		}
+	}
+
+	pruneHoldings(cp)
+	return nil
+}
+
+// bestCross returns the positions in cp.Bids and cp.PT4Sale of the next pair
+// to fill, or -1, -1 when nothing crosses.
+func bestCross(cp *PTY) (int, int) {
+	bids := bidPriority(cp.Bids)
+	asks := askPriority(cp.PT4Sale)
+
+	for _, b := range bids {
+		bid := cp.Bids[b]
+		for _, a := range asks {
+			ask := cp.PT4Sale[a]
+			if ask.SellVal > bid.LimitPrice {
+				break
+			}
+			if ask.InvestorID == bid.InvestorID {
+				continue
+			}
+			return b, a
+		}
+	}
+	return -1, -1
+}
+
+// bidPriority orders bids highest price first, then oldest first.
+func bidPriority(bids []Bid) []int {
+	order := bidOrder{bids: bids}
+	for key, bid := range bids {
+		if bid.Quantity > 0 {
+			order.keys = append(order.keys, key)
+		}
+	}
+	sort.Stable(order)
+	return order.keys
+}
+
+// askPriority orders asks lowest price first, then oldest first.
+func askPriority(asks []ForSale) []int {
+	order := askOrder{asks: asks}
+	for key, ask := range asks {
+		if ask.Quantity > 0 {
+			order.keys = append(order.keys, key)
+		}
+	}
+	sort.Stable(order)
+	return order.keys
+}
+
+type bidOrder struct {
+	bids []Bid
+	keys []int
+}
+
+func (o bidOrder) Len() int      { return len(o.keys) }
+func (o bidOrder) Swap(i, j int) { o.keys[i], o.keys[j] = o.keys[j], o.keys[i] }
+func (o bidOrder) Less(i, j int) bool {
+	a, b := o.bids[o.keys[i]], o.bids[o.keys[j]]
+	if a.LimitPrice != b.LimitPrice {
+		return a.LimitPrice > b.LimitPrice
+	}
+	return a.Seq < b.Seq
+}
+
+type askOrder struct {
+	asks []ForSale
+	keys []int
+}
+
+func (o askOrder) Len() int      { return len(o.keys) }
+func (o askOrder) Swap(i, j int) { o.keys[i], o.keys[j] = o.keys[j], o.keys[i] }
+func (o askOrder) Less(i, j int) bool {
+	a, b := o.asks[o.keys[i]], o.asks[o.keys[j]]
+	if a.SellVal != b.SellVal {
+		return a.SellVal < b.SellVal
+	}
+	return a.Seq < b.Seq
+}
+
+func GetOrderBook(cusip string, stub StateStub) (OrderBook, error) {
+	var book OrderBook
+	cp, err := GetPTY(cusip, stub)
+	if err != nil {
+		return book, err
+	}
+
+	book.CUSIP = cp.CUSIP
+	for _, key := range bidPriority(cp.Bids) {
+		book.Bids = append(book.Bids, cp.Bids[key])
+	}
+	for _, key := range askPriority(cp.PT4Sale) {
+		book.Asks = append(book.Asks, cp.PT4Sale[key])
+	}
+	return book, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBestCross(t *testing.T) {
+	tests := []struct {
+		name    string
+		bids    []Bid
+		asks    []ForSale
+		wantBid int
+		wantAsk int
+	}{
+		{
+			name:    "nothing crosses",
+			bids:    []Bid{{Seq: 1, InvestorID: "b", Quantity: 1, LimitPrice: 900}},
+			asks:    []ForSale{{Seq: 2, InvestorID: "s", Quantity: 1, SellVal: 1000}},
+			wantBid: -1, wantAsk: -1,
+		},
+		{
+			name: "highest bid meets lowest ask",
+			bids: []Bid{
+				{Seq: 1, InvestorID: "b1", Quantity: 1, LimitPrice: 1000},
+				{Seq: 2, InvestorID: "b2", Quantity: 1, LimitPrice: 1200},
+			},
+			asks: []ForSale{
+				{Seq: 3, InvestorID: "s1", Quantity: 1, SellVal: 1100},
+				{Seq: 4, InvestorID: "s2", Quantity: 1, SellVal: 900},
+			},
+			wantBid: 1, wantAsk: 1,
+		},
+		{
+			name: "earlier order first at the same price",
+			bids: []Bid{
+				{Seq: 5, InvestorID: "b1", Quantity: 1, LimitPrice: 1000},
+				{Seq: 2, InvestorID: "b2", Quantity: 1, LimitPrice: 1000},
+			},
+			asks: []ForSale{
+				{Seq: 4, InvestorID: "s1", Quantity: 1, SellVal: 1000},
+				{Seq: 3, InvestorID: "s2", Quantity: 1, SellVal: 1000},
+			},
+			wantBid: 1, wantAsk: 1,
+		},
+		{
+			name: "a holder's bid skips their own ask",
+			bids: []Bid{{Seq: 1, InvestorID: "s1", Quantity: 1, LimitPrice: 1000}},
+			asks: []ForSale{
+				{Seq: 2, InvestorID: "s1", Quantity: 1, SellVal: 800},
+				{Seq: 3, InvestorID: "s2", Quantity: 1, SellVal: 900},
+			},
+			wantBid: 0, wantAsk: 1,
+		},
+		{
+			name:    "empty orders are ignored",
+			bids:    []Bid{{Seq: 1, InvestorID: "b", Quantity: 0, LimitPrice: 1000}},
+			asks:    []ForSale{{Seq: 2, InvestorID: "s", Quantity: 1, SellVal: 900}},
+			wantBid: -1, wantAsk: -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := PTY{Bids: tt.bids, PT4Sale: tt.asks}
+			bid, ask := bestCross(&cp)
+			if bid != tt.wantBid || ask != tt.wantAsk {
+				t.Errorf("bestCross = %d, %d, want %d, %d", bid, ask, tt.wantBid, tt.wantAsk)
+			}
+		})
+	}
+}
+
+func TestMatchOrders(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	bid := func(investorID string, quantity int, price string) {
+		l.t.Helper()
+		l.invoke(investorID, "placeBid", "{'cusip':'"+cusip+"','invid':'"+investorID+"','quantity':"+strconv.Itoa(quantity)+",'limitPrice':"+price+"}")
+	}
+
+	bid("company2", 10, "9")
+	bid("company3", 5, "11")
+	bid("company4", 5, "11")
+	l.invokeErr("company2", "placeBid", "{'cusip':'"+cusip+"','invid':'company2','quantity':1000000000,'limitPrice':100}")
+
+	// The two bids at 11 fill in the order they were placed, at their own
+	// price since they were resting first. The bid at 9 doesn't cross.
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':12,'sellval':10}")
+	cp := l.pty(cusip)
+	for _, investorID := range []string{"company3", "company4"} {
+		if owned, _ := holdingOf(cp, investorID); owned != 5 {
+			t.Errorf("%s owns %d, want 5", investorID, owned)
+		}
+	}
+	if _, listed := holdingOf(cp, "company1"); listed != 2 {
+		t.Errorf("company1 has %d listed, want 2", listed)
+	}
+	if got := l.cash("company1"); got != defaultCashBalance+11000 {
+		t.Errorf("company1 has %s, want 110.00 more", got)
+	}
+
+	// A new bid at 10.50 takes the 2 left at the resting ask price of 10
+	bid("company2", 5, "10.5")
+	if owned, _ := holdingOf(l.pty(cusip), "company2"); owned != 2 {
+		t.Errorf("company2 owns %d, want 2", owned)
+	}
+	if got := l.cash("company2"); got != defaultCashBalance-2000 {
+		t.Errorf("company2 has %s, want 20.00 less", got)
+	}
+
+	var book OrderBook
+	l.queryJSON(&book, "GetOrderBook", cusip)
+	if len(book.Asks) != 0 || len(book.Bids) != 2 || book.Bids[0].LimitPrice != 1050 || book.Bids[0].Quantity != 3 || book.Bids[1].LimitPrice != 900 {
+		t.Fatalf("book is %+v", book)
+	}
+
+	seq := strconv.Itoa(book.Bids[0].Seq)
+	l.invokeErr("company3", "cancelBid", "{'cusip':'"+cusip+"','invid':'company3','seq':"+seq+"}")
+	l.invoke("company2", "cancelBid", "{'cusip':'"+cusip+"','invid':'company2','seq':"+seq+"}")
+	if bids := l.pty(cusip).Bids; len(bids) != 1 || bids[0].LimitPrice != 900 {
+		t.Errorf("bids after cancelling are %+v", bids)
+	}
+
+	// company1's own bid doesn't fill against its own listing, but company2's
+	// resting bid at 9 does, at 9
+	l.invoke("company1", "placeBid", "{'cusip':'"+cusip+"','invid':'company1','quantity':1,'limitPrice':8}")
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':5,'sellval':8}")
+	if owned, _ := holdingOf(l.pty(cusip), "company2"); owned != 7 {
+		t.Errorf("company2 owns %d, want 7", owned)
+	}
+	l.verify()
+}
+
+func TestSetForSaleValidation(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+
+	tests := []struct {
+		name     string
+		quantity string
+		sellval  string
+	}{
+		{"negative quantity", "-5", "10"},
+		{"zero quantity", "0", "10"},
+		{"zero price", "5", "0"},
+		{"negative price", "5", "-1"},
+		{"more than is owned", "101", "10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			l.invokeErr("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':"+tt.quantity+",'sellval':"+tt.sellval+"}")
+		})
+	}
+	l.t = t
+
+	// A zero price ask would otherwise fill this bid for nothing
+	l.invoke("company2", "placeBid", "{'cusip':'"+cusip+"','invid':'company2','quantity':5,'limitPrice':9}")
+	l.invokeErr("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':5,'sellval':0}")
+	if owned, listed := holdingOf(l.pty(cusip), "company1"); owned != 100 || listed != 0 {
+		t.Errorf("company1 holds %d owned and %d listed, want all 100 owned", owned, listed)
+	}
+	l.verify()
+}
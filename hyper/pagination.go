@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// PageQuery selects a page of a time-ordered index. From and To are
+// inclusive millisecond timestamps and either may be left blank. Bookmark is
+// the value returned with the previous page.
+type PageQuery struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Bookmark string `json:"bookmark"`
+	Limit    int    `json:"limit"`
+}
+
+// padMillis left pads a millisecond timestamp so timestamps sort the same
+// way as strings as they do as numbers.
+func padMillis(ms string) string {
+	if len(ms) >= 16 {
+		return ms
+	}
+	return strings.Repeat("0", 16-len(ms)) + ms
+}
+
+// errSkipEntry can be returned by a pageIndex visit function for an entry
+// its filters leave out, so the entry doesn't count toward the limit.
+var errSkipEntry = errors.New("skip entry")
+
+// pageIndex walks the index entries under prefix whose next key attribute is
+// a padded timestamp inside the query's range, and calls visit with the
+// value of at most Limit of them. It returns the bookmark for the next page,
+// or "" when there are no more entries.
+func pageIndex(stub StateStub, prefix string, q PageQuery, visit func(key string, value []byte) error) (string, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	startKey := prefix
+	if q.From != "" {
+		startKey = prefix + padMillis(q.From)
+	}
+	endKey := prefix + "\xff"
+	if q.To != "" {
+		endKey = prefix + padMillis(q.To) + "\x00\xff"
+	}
+	if q.Bookmark != "" {
+		if !strings.HasPrefix(q.Bookmark, prefix) {
+			return "", errors.New("Bookmark does not belong to this query")
+		}
+		if q.Bookmark+"\x00" > startKey {
+			startKey = q.Bookmark + "\x00"
+		}
+	}
+
+	count := 0
+	lastKey := ""
+	bookmark := ""
+	err := scanRange(stub, startKey, endKey, func(key string, value []byte) error {
+		if count == limit {
+			bookmark = lastKey
+			return errStopScan
+		}
+		err := visit(key, value)
+		if err == errSkipEntry {
+			return nil
+		}
+		count++
+		lastKey = key
+		return err
+	})
+	return bookmark, err
+}
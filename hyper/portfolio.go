@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Position is an account's holding in one property, valued at the
+// property's market value. Share is the fraction of the property's tokens
+// held, and RentIncome the rent the account has received from it to date.
+type Position struct {
+	CUSIP      string  `json:"cusip"`
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Owned      int     `json:"owned"`
+	Listed     int     `json:"listed"`
+	Quantity   int     `json:"quantity"`
+	TokenValue Money   `json:"tokenValue"`
+	Value      Money   `json:"value"`
+	Share      float64 `json:"share"`
+	RentIncome Money   `json:"rentIncome"`
+}
+
+// Portfolio is what an account is worth: its cash, the deposits it has in
+// escrow, and its positions. RentIncome includes rent from properties the
+// account no longer holds.
+type Portfolio struct {
+	InvestorID    string     `json:"invid"`
+	Cash          Money      `json:"cash"`
+	Escrow        Money      `json:"escrow"`
+	Positions     []Position `json:"positions"`
+	HoldingsValue Money      `json:"holdingsValue"`
+	RentIncome    Money      `json:"rentIncome"`
+	NetWorth      Money      `json:"netWorth"`
+}
+
+// GetPortfolio values every property an account owns or has listed tokens
+// of, found through the holder index.
+func GetPortfolio(investorID string, stub StateStub) (Portfolio, error) {
+	var portfolio Portfolio
+	account, err := GetCompany(investorID, stub)
+	if err != nil {
+		return portfolio, err
+	}
+	portfolio.InvestorID = account.ID
+	portfolio.Cash = account.CashBalance
+	portfolio.Escrow = account.Escrow
+
+	rqBytes, err := json.Marshal(RentQuery{Owner: account.ID})
+	if err != nil {
+		return portfolio, errors.New("Error building rent query for " + account.ID)
+	}
+	income, err := GetRentalIncome(string(rqBytes), stub)
+	if err != nil {
+		return portfolio, err
+	}
+	portfolio.RentIncome = income.Total
+	rentByCUSIP := map[string]Money{}
+	for _, property := range income.Properties {
+		rentByCUSIP[property.CUSIP] = property.Amount
+	}
+
+	cusips, err := indexedCUSIPs(stub, ptysByHolder, account.ID)
+	if err != nil {
+		return portfolio, err
+	}
+	for _, cusip := range cusips {
+		cp, err := GetPTY(cusip, stub)
+		if err != nil {
+			return portfolio, err
+		}
+		owned, listed := holdingOf(cp, account.ID)
+		if owned+listed == 0 {
+			fmt.Println("Holder index lists " + account.ID + " on " + cusip + " but nothing is held")
+			continue
+		}
+
+		var position Position
+		position.CUSIP = cp.CUSIP
+		position.Name = cp.Name
+		position.Status = cp.Status
+		position.Owned = owned
+		position.Listed = listed
+		position.Quantity = owned + listed
+		if cp.Qty > 0 {
+			position.TokenValue = cp.MktValue.Div(cp.Qty)
+			position.Value = cp.MktValue.MulInt(position.Quantity).Div(cp.Qty)
+			position.Share = float64(position.Quantity) / float64(cp.Qty)
+		}
+		position.RentIncome = rentByCUSIP[cp.CUSIP]
+		portfolio.Positions = append(portfolio.Positions, position)
+		portfolio.HoldingsValue += position.Value
+	}
+
+	portfolio.NetWorth = portfolio.Cash + portfolio.Escrow + portfolio.HoldingsValue
+	return portfolio, nil
+}
+
+// holdingOf returns how many tokens of cp investorID owns and has listed.
+func holdingOf(cp PTY, investorID string) (int, int) {
+	owned, listed := 0, 0
+	for _, owner := range cp.Owners {
+		if owner.InvestorID == investorID {
+			owned += owner.Quantity
+		}
+	}
+	for _, forsale := range cp.PT4Sale {
+		if forsale.InvestorID == investorID {
+			listed += forsale.Quantity
+		}
+	}
+	return owned, listed
+}
@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestGetPortfolio(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':40,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':10}")
+	lease := string(l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':500,'start':'0','end':'31536000000'}"))
+	l.invoke("company4", "acceptLease", "{'leaseId':'"+lease+"'}")
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4'}")
+
+	// Nobody has valued the second property yet
+	l.invoke("company1", "issuePropertyToken", "{'name':'2 Main St','adrStreet':'2 Main St','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':50,'issuer':'company1','rent':1000}")
+	unvalued, err := genHash("2 Main StAustin78701TX")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var portfolio Portfolio
+	l.queryJSON(&portfolio, "GetPortfolio", "company1")
+	if len(portfolio.Positions) != 2 {
+		t.Fatalf("company1 has positions %+v", portfolio.Positions)
+	}
+	positions := map[string]Position{}
+	for _, position := range portfolio.Positions {
+		positions[position.CUSIP] = position
+	}
+
+	// 60 owned and 30 still listed of 100 tokens worth 1000 each
+	valued := positions[cusip]
+	if valued.Owned != 60 || valued.Listed != 30 || valued.Quantity != 90 || valued.Share != 0.9 {
+		t.Errorf("valued position is %+v", valued)
+	}
+	if valued.TokenValue != 100000 || valued.Value != 9000000 || valued.RentIncome != 90000 {
+		t.Errorf("valued position is worth %s a token, %s in all, with %s rent", valued.TokenValue, valued.Value, valued.RentIncome)
+	}
+	if p := positions[unvalued]; p.Quantity != 50 || p.Share != 1 || p.TokenValue != 0 || p.Value != 0 {
+		t.Errorf("unvalued position is %+v", p)
+	}
+	if portfolio.HoldingsValue != 9000000 || portfolio.RentIncome != 90000 || portfolio.NetWorth != portfolio.Cash+9000000 {
+		t.Errorf("company1's portfolio is %+v", portfolio)
+	}
+
+	portfolio = Portfolio{}
+	l.queryJSON(&portfolio, "GetPortfolio", "company2")
+	if len(portfolio.Positions) != 1 || portfolio.Positions[0].Owned != 10 || portfolio.Positions[0].Value != 1000000 {
+		t.Errorf("company2 has positions %+v", portfolio.Positions)
+	}
+	if portfolio.RentIncome != 10000 || portfolio.NetWorth != portfolio.Cash+1000000 {
+		t.Errorf("company2's portfolio is %+v", portfolio)
+	}
+
+	// The tenant holds nothing, but its deposit still counts
+	portfolio = Portfolio{}
+	l.queryJSON(&portfolio, "GetPortfolio", "company4")
+	if len(portfolio.Positions) != 0 || portfolio.Escrow != 50000 || portfolio.NetWorth != portfolio.Cash+50000 {
+		t.Errorf("company4's portfolio is %+v", portfolio)
+	}
+	if _, err := l.stub.MockQuery(l.cc, "query", []string{"GetPortfolio", "nobody"}); err == nil {
+		t.Error("GetPortfolio found an account that doesn't exist")
+	}
+}
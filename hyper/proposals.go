@@ -0,0 +1,502 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var proposalPrefix = "proposal:"
+
+// Index object type for proposals. Each entry's key is (type, cusip, padded
+// timestamp, proposal ID), so GetProposals lists a property's proposals
+// oldest first.
+const proposalsByCUSIP = "proposal~cusip"
+
+const (
+	proposalOpen     = "Open"
+	proposalPassed   = "Passed"
+	proposalRejected = "Rejected"
+)
+
+const (
+	voteYes     = "yes"
+	voteNo      = "no"
+	voteAbstain = "abstain"
+)
+
+// Actions a passed proposal carries out when it is closed.
+const (
+	actionNone       = ""
+	actionSetRent    = "setRent"
+	actionPayExpense = "payExpense"
+	actionSuspend    = "suspend"
+	actionDelist     = "delist"
+	actionSell       = "sell"
+)
+
+const (
+	defaultQuorumPct    = 50
+	defaultThresholdPct = 50
+)
+
+// Proposal is a decision put to a property's holders. Votes are weighted by
+// the quantity each holder had when the proposal was made.
+type Proposal struct {
+	ProposalID   string         `json:"proposalId"`
+	CUSIP        string         `json:"cusip"`
+	Proposer     string         `json:"proposer"`
+	Title        string         `json:"title"`
+	Description  string         `json:"description"`
+	Action       ProposalAction `json:"action"`
+	QuorumPct    int            `json:"quorumPct"`
+	ThresholdPct int            `json:"thresholdPct"`
+	Snapshot     []Owner        `json:"snapshot"`
+	TotalWeight  int            `json:"totalWeight"`
+	Votes        []Vote         `json:"votes"`
+	Yes          int            `json:"yes"`
+	No           int            `json:"no"`
+	Abstain      int            `json:"abstain"`
+	Opened       string         `json:"opened"`
+	Closes       string         `json:"closes"`
+	Status       string         `json:"status"`
+	Closed       string         `json:"closed"`
+	Executed     bool           `json:"executed"`
+	ActionResult string         `json:"actionResult"`
+}
+
+// ProposalAction is what happens if a proposal passes. Rent is used by
+// setRent, ExpenseID and Amount by payExpense, and Buyer and Amount by sell.
+type ProposalAction struct {
+	Type      string `json:"type"`
+	Rent      Money  `json:"rent"`
+	ExpenseID string `json:"expenseId"`
+	Buyer     string `json:"buyer"`
+	Amount    Money  `json:"amount"`
+}
+
+type Vote struct {
+	InvestorID string `json:"invid"`
+	Choice     string `json:"choice"`
+	Weight     int    `json:"weight"`
+	Cast       string `json:"cast"`
+}
+
+// MakeProposal is the payload of propose. QuorumPct and ThresholdPct are
+// pointers so that leaving them out, which takes the defaults, can be told
+// apart from setting them to 0.
+type MakeProposal struct {
+	CUSIP        string         `json:"cusip"`
+	Proposer     string         `json:"invid"`
+	Title        string         `json:"title"`
+	Description  string         `json:"description"`
+	Action       ProposalAction `json:"action"`
+	QuorumPct    *int           `json:"quorumPct"`
+	ThresholdPct *int           `json:"thresholdPct"`
+	Closes       string         `json:"closes"`
+}
+
+type CastVote struct {
+	ProposalID string `json:"proposalId"`
+	InvestorID string `json:"invid"`
+	Choice     string `json:"choice"`
+}
+
+type CloseProposal struct {
+	ProposalID string `json:"proposalId"`
+}
+
+type ProposalQuery struct {
+	CUSIP  string `json:"cusip"`
+	Status string `json:"status"`
+	PageQuery
+}
+
+type ProposalPage struct {
+	Proposals []Proposal `json:"proposals"`
+	Bookmark  string     `json:"bookmark"`
+}
+
+// propose puts a decision to a property's holders. Any holder or the issuer
+// can propose. The holders and their quantities are fixed from this point,
+// so tokens bought afterwards don't vote.
+func (t *SimpleChaincode) propose(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting proposal record")
+	}
+
+	var mp MakeProposal
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &mp)
+	if err != nil {
+		fmt.Println("Error Unmarshalling MakeProposal")
+		return nil, errors.New("Invalid proposal record")
+	}
+
+	proposer, err := requireCaller(stub, mp.Proposer, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	cp, err := GetPTY(mp.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	if hasStatus(cp, statusDelisted, statusSold) {
+		return nil, errors.New("Property " + cp.CUSIP + " is " + cp.Status)
+	}
+
+	snapshot := holdersOf(cp)
+	if proposer.ID != cp.Issuer && holderWeight(snapshot, proposer.ID) == 0 {
+		return nil, errors.New("Only holders of " + cp.CUSIP + " or its issuer can make proposals")
+	}
+
+	quorumPct := defaultQuorumPct
+	if mp.QuorumPct != nil {
+		quorumPct = *mp.QuorumPct
+	}
+	thresholdPct := defaultThresholdPct
+	if mp.ThresholdPct != nil {
+		thresholdPct = *mp.ThresholdPct
+	}
+	if quorumPct < 0 || quorumPct > 100 || thresholdPct < 0 || thresholdPct >= 100 {
+		return nil, errors.New("Quorum must be 0 to 100 percent and threshold 0 to 99 percent")
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+	if !millisBefore(now, mp.Closes) {
+		return nil, errors.New("Proposals must close at a time in milliseconds after now")
+	}
+
+	err = checkProposalAction(stub, cp, mp.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	var proposal Proposal
+	proposal.ProposalID, err = newRecordID(stub, proposalPrefix)
+	if err != nil {
+		return nil, err
+	}
+	proposal.CUSIP = cp.CUSIP
+	proposal.Proposer = proposer.ID
+	proposal.Title = mp.Title
+	proposal.Description = mp.Description
+	proposal.Action = mp.Action
+	proposal.QuorumPct = quorumPct
+	proposal.ThresholdPct = thresholdPct
+	proposal.Snapshot = snapshot
+	for _, holder := range snapshot {
+		proposal.TotalWeight += holder.Quantity
+	}
+	proposal.Opened = now
+	proposal.Closes = mp.Closes
+	proposal.Status = proposalOpen
+
+	err = putProposal(stub, proposal)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(compositeKey(proposalsByCUSIP, cp.CUSIP, padMillis(now), proposal.ProposalID), []byte(proposal.ProposalID))
+	if err != nil {
+		return nil, errors.New("Error writing proposal index for " + proposal.ProposalID)
+	}
+
+	fmt.Println("Opened proposal " + proposal.ProposalID + " on " + cp.CUSIP)
+	return []byte(proposal.ProposalID), nil
+}
+
+// vote casts a holder's snapshot quantity for, against or abstaining on an
+// open proposal. Each holder votes once.
+func (t *SimpleChaincode) vote(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting vote record")
+	}
+
+	var cv CastVote
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &cv)
+	if err != nil {
+		fmt.Println("Error Unmarshalling CastVote")
+		return nil, errors.New("Invalid vote record")
+	}
+
+	voter, err := requireCaller(stub, cv.InvestorID, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal, err := GetProposal(cv.ProposalID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != proposalOpen {
+		return nil, errors.New("Proposal " + proposal.ProposalID + " is " + proposal.Status)
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+	if !millisBefore(now, proposal.Closes) {
+		return nil, errors.New("Voting on proposal " + proposal.ProposalID + " has closed")
+	}
+
+	weight := holderWeight(proposal.Snapshot, voter.ID)
+	if weight == 0 {
+		return nil, errors.New(voter.ID + " held no tokens when proposal " + proposal.ProposalID + " was made")
+	}
+	for _, v := range proposal.Votes {
+		if v.InvestorID == voter.ID {
+			return nil, errors.New(voter.ID + " has already voted on proposal " + proposal.ProposalID)
+		}
+	}
+
+	switch cv.Choice {
+	case voteYes:
+		proposal.Yes += weight
+	case voteNo:
+		proposal.No += weight
+	case voteAbstain:
+		proposal.Abstain += weight
+	default:
+		return nil, errors.New("A vote must be " + voteYes + ", " + voteNo + " or " + voteAbstain)
+	}
+	proposal.Votes = append(proposal.Votes, Vote{InvestorID: voter.ID, Choice: cv.Choice, Weight: weight, Cast: now})
+
+	err = putProposal(stub, proposal)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// closeProposal counts the votes once voting has closed, or earlier when
+// every holder has voted, and carries out the action if the proposal
+// passed. Anyone can close a proposal. If the action can't be carried out
+// the proposal still passes and ActionResult says why.
+func (t *SimpleChaincode) closeProposal(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting close record")
+	}
+
+	var cl CloseProposal
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &cl)
+	if err != nil {
+		fmt.Println("Error Unmarshalling CloseProposal")
+		return nil, errors.New("Invalid close record")
+	}
+
+	_, err = getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal, err := GetProposal(cl.ProposalID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != proposalOpen {
+		return nil, errors.New("Proposal " + proposal.ProposalID + " is " + proposal.Status)
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+	turnout := proposal.Yes + proposal.No + proposal.Abstain
+	if millisBefore(now, proposal.Closes) && turnout < proposal.TotalWeight {
+		return nil, errors.New("Voting on proposal " + proposal.ProposalID + " is still open")
+	}
+
+	proposal.Closed = now
+	proposal.Status = proposalRejected
+	if proposalPasses(proposal) {
+		proposal.Status = proposalPassed
+	}
+	fmt.Println("Proposal " + proposal.ProposalID + " " + proposal.Status)
+
+	if proposal.Status == proposalPassed && proposal.Action.Type == actionSell {
+		// The buyer has to pay, so they complete the sale with sellProperty
+		proposal.ActionResult = "Waiting for " + proposal.Action.Buyer + " to complete the sale"
+	} else if proposal.Status == proposalPassed && proposal.Action.Type != actionNone {
+		cp, err := GetPTY(proposal.CUSIP, stub)
+		if err != nil {
+			return nil, err
+		}
+		err = runProposalAction(stub, &cp, proposal, now)
+		if err != nil {
+			fmt.Println("Proposal " + proposal.ProposalID + " action failed: " + err.Error())
+			proposal.ActionResult = err.Error()
+		} else {
+			err = putPTY(stub, cp)
+			if err != nil {
+				return nil, err
+			}
+			proposal.Executed = true
+			proposal.ActionResult = "Done"
+		}
+	}
+
+	err = putProposal(stub, proposal)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// proposalPasses applies the quorum to everything voted, abstentions
+// included, and the threshold to the yes and no votes.
+func proposalPasses(proposal Proposal) bool {
+	turnout := proposal.Yes + proposal.No + proposal.Abstain
+	if turnout*100 < proposal.QuorumPct*proposal.TotalWeight {
+		return false
+	}
+	return proposal.Yes > 0 && proposal.Yes*100 > proposal.ThresholdPct*(proposal.Yes+proposal.No)
+}
+
+// checkProposalAction rejects actions that could never be carried out.
+func checkProposalAction(stub StateStub, cp PTY, action ProposalAction) error {
+	switch action.Type {
+	case actionNone, actionSuspend, actionDelist:
+		return nil
+	case actionSetRent:
+		if action.Rent <= 0 {
+			return errors.New("A setRent proposal needs a positive rent")
+		}
+		return nil
+	case actionPayExpense:
+		expense, err := GetExpense(action.ExpenseID, stub)
+		if err != nil {
+			return err
+		}
+		if expense.CUSIP != cp.CUSIP || expense.Status != expenseOutstanding {
+			return errors.New("Expense " + expense.ExpenseID + " is not outstanding on " + cp.CUSIP)
+		}
+		if action.Amount < 0 {
+			return errors.New("Expense payments can't be negative")
+		}
+		return nil
+	case actionSell:
+		_, err := GetCompany(action.Buyer, stub)
+		if err != nil {
+			return errors.New("Buyer " + action.Buyer + " has no account")
+		}
+		if action.Amount <= 0 {
+			return errors.New("A sale needs a positive price")
+		}
+		return nil
+	}
+	return errors.New("Unknown proposal action " + action.Type)
+}
+
+// runProposalAction carries out a passed proposal's action on cp in memory.
+// Other records it touches are written here.
+func runProposalAction(stub StateStub, cp *PTY, proposal Proposal, now string) error {
+	by := "proposal " + proposal.ProposalID
+	action := proposal.Action
+	if hasStatus(*cp, statusSold) {
+		return errors.New("Property " + cp.CUSIP + " has been sold")
+	}
+	switch action.Type {
+	case actionSetRent:
+		cp.Rent = action.Rent
+		return nil
+	case actionSuspend:
+		return setStatus(cp, statusSuspended, by, proposal.Title, now)
+	case actionDelist:
+		return setStatus(cp, statusDelisted, by, proposal.Title, now)
+	case actionPayExpense:
+		expense, err := GetExpense(action.ExpenseID, stub)
+		if err != nil {
+			return err
+		}
+		if expense.Status != expenseOutstanding {
+			return errors.New("Expense " + expense.ExpenseID + " is " + expense.Status)
+		}
+		amount := action.Amount
+		owed := expense.Amount - expense.Paid
+		if amount == 0 || amount > owed {
+			amount = owed
+		}
+		return payFromReserveOf(stub, cp, expense, amount, by, now)
+	}
+	return errors.New("Unknown proposal action " + action.Type)
+}
+
+func holderWeight(holders []Owner, id string) int {
+	for _, holder := range holders {
+		if holder.InvestorID == id {
+			return holder.Quantity
+		}
+	}
+	return 0
+}
+
+// millisBefore reports whether timestamp a is before b. Both are
+// milliseconds as strings; anything unparseable counts as zero.
+func millisBefore(a string, b string) bool {
+	aMs, _ := strconv.ParseInt(a, 10, 64)
+	bMs, _ := strconv.ParseInt(b, 10, 64)
+	return aMs < bMs
+}
+
+func putProposal(stub StateStub, proposal Proposal) error {
+	proposalBytes, err := json.Marshal(&proposal)
+	if err != nil {
+		fmt.Println("Error marshalling proposal " + proposal.ProposalID)
+		return errors.New("Error marshalling proposal " + proposal.ProposalID)
+	}
+	err = stub.PutState(proposalPrefix+proposal.ProposalID, proposalBytes)
+	if err != nil {
+		fmt.Println("Error writing proposal " + proposal.ProposalID)
+		return errors.New("Error writing proposal " + proposal.ProposalID)
+	}
+	return nil
+}
+
+func GetProposal(proposalID string, stub StateStub) (Proposal, error) {
+	var proposal Proposal
+	proposalBytes, err := stub.GetState(proposalPrefix + proposalID)
+	if err != nil || proposalBytes == nil {
+		fmt.Println("Proposal not found " + proposalID)
+		return proposal, errors.New("Proposal not found " + proposalID)
+	}
+	err = json.Unmarshal(proposalBytes, &proposal)
+	if err != nil {
+		fmt.Println("Error unmarshalling proposal " + proposalID)
+		return proposal, errors.New("Error unmarshalling proposal " + proposalID)
+	}
+	return proposal, nil
+}
+
+// GetProposals pages through a property's proposals, oldest first,
+// optionally only those with the given status.
+func GetProposals(args string, stub StateStub) (ProposalPage, error) {
+	var page ProposalPage
+	var pq ProposalQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &pq)
+	if err != nil || pq.CUSIP == "" {
+		return page, errors.New("GetProposals expects {\"cusip\": ...}")
+	}
+
+	bookmark, err := pageIndex(stub, compositeKey(proposalsByCUSIP, pq.CUSIP), pq.PageQuery, func(key string, value []byte) error {
+		proposal, err := GetProposal(string(value), stub)
+		if err != nil {
+			return err
+		}
+		if pq.Status != "" && proposal.Status != pq.Status {
+			return errSkipEntry
+		}
+		page.Proposals = append(page.Proposals, proposal)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+	page.Bookmark = bookmark
+	return page, nil
+}
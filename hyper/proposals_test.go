@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestProposalPasses(t *testing.T) {
+	tests := []struct {
+		name         string
+		quorumPct    int
+		thresholdPct int
+		yes          int
+		no           int
+		abstain      int
+		want         bool
+	}{
+		{"majority with quorum", 50, 50, 30, 20, 0, true},
+		{"abstentions count toward quorum", 50, 50, 10, 5, 35, true},
+		{"short of quorum", 50, 50, 30, 10, 0, false},
+		{"tie is not a majority", 50, 50, 25, 25, 0, false},
+		{"threshold above a simple majority", 50, 60, 30, 20, 0, false},
+		{"no quorum needed", 0, 50, 1, 0, 0, true},
+		{"no votes at all", 0, 0, 0, 0, 0, false},
+		{"zero threshold still needs a yes", 0, 0, 0, 10, 0, false},
+		{"everyone must vote", 100, 50, 60, 30, 9, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proposal := Proposal{QuorumPct: tt.quorumPct, ThresholdPct: tt.thresholdPct, TotalWeight: 100, Yes: tt.yes, No: tt.no, Abstain: tt.abstain}
+			if got := proposalPasses(proposal); got != tt.want {
+				t.Errorf("proposalPasses is %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProposals(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':30}")
+	l.invoke("company3", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company3','quantity':20}")
+	closes := strconv.FormatInt(l.stub.TxTime.Add(10*time.Second).UnixNano()/nanosPerMillisecond, 10)
+	propose := func(invid string, rest string) string {
+		l.t.Helper()
+		return string(l.invoke(invid, "propose", "{'cusip':'"+cusip+"','invid':'"+invid+"','closes':'"+closes+"',"+rest+"}"))
+	}
+	proposal := func(id string) Proposal {
+		l.t.Helper()
+		var p Proposal
+		l.queryJSON(&p, "GetProposal", id)
+		return p
+	}
+
+	l.invokeErr("company4", "propose", "{'cusip':'"+cusip+"','invid':'company4','closes':'"+closes+"','title':'not a holder'}")
+	for _, pcts := range []string{"'quorumPct':101", "'quorumPct':-1", "'thresholdPct':100", "'thresholdPct':-1"} {
+		l.invokeErr("company2", "propose", "{'cusip':'"+cusip+"','invid':'company2','closes':'"+closes+"',"+pcts+"}")
+	}
+	l.invokeErr("company2", "propose", "{'cusip':'"+cusip+"','invid':'company2','closes':'"+l.millis()+"'}")
+	l.invokeErr("company2", "propose", "{'cusip':'"+cusip+"','invid':'company2','closes':'"+closes+"','action':{'type':'setRent','rent':0}}")
+
+	// Votes are weighted by the holdings when the proposal was made, so
+	// company2's later purchase doesn't count and company4 can't vote
+	rent := propose("company2", "'title':'raise the rent','action':{'type':'setRent','rent':1200}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':10}")
+	l.invoke("company4", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company4','quantity':10}")
+	l.invoke("company2", "vote", "{'proposalId':'"+rent+"','invid':'company2','choice':'yes'}")
+	l.invokeErr("company2", "vote", "{'proposalId':'"+rent+"','invid':'company2','choice':'no'}")
+	l.invokeErr("company4", "vote", "{'proposalId':'"+rent+"','invid':'company4','choice':'yes'}")
+	l.invokeErr("company3", "vote", "{'proposalId':'"+rent+"','invid':'company3','choice':'maybe'}")
+	l.invoke("company3", "vote", "{'proposalId':'"+rent+"','invid':'company3','choice':'no'}")
+	if p := proposal(rent); p.TotalWeight != 100 || p.Yes != 30 || p.No != 20 {
+		t.Fatalf("proposal has weight %d with %d yes and %d no", p.TotalWeight, p.Yes, p.No)
+	}
+
+	// Once every holder in the snapshot has voted it can close early
+	l.invokeErr("company2", "closeProposal", "{'proposalId':'"+rent+"'}")
+	l.invoke("company1", "vote", "{'proposalId':'"+rent+"','invid':'company1','choice':'abstain'}")
+	l.invoke("company2", "closeProposal", "{'proposalId':'"+rent+"'}")
+	l.invokeErr("company2", "closeProposal", "{'proposalId':'"+rent+"'}")
+	if p := proposal(rent); p.Status != proposalPassed || !p.Executed || l.pty(cusip).Rent != 120000 {
+		t.Fatalf("proposal is %s, executed %v, and rent is %s", p.Status, p.Executed, l.pty(cusip).Rent)
+	}
+
+	// company3's 20 of 100 misses the default quorum of 50, but is enough
+	// when the quorum is explicitly 0
+	defaults := propose("company3", "'title':'defaults','action':{'type':'suspend'}")
+	noQuorum := propose("company3", "'title':'no quorum','quorumPct':0,'thresholdPct':0,'action':{'type':'suspend'}")
+	expense := string(l.invoke("company1", "recordExpense", "{'cusip':'"+cusip+"','category':'repairs','amount':300,'payee':'company2'}"))
+	payExpense := propose("company3", "'title':'pay repairs','quorumPct':0,'action':{'type':'payExpense','expenseId':'"+expense+"'}")
+	for _, id := range []string{defaults, noQuorum, payExpense} {
+		l.invoke("company3", "vote", "{'proposalId':'"+id+"','invid':'company3','choice':'yes'}")
+	}
+	if p := proposal(defaults); p.QuorumPct != defaultQuorumPct || p.ThresholdPct != defaultThresholdPct {
+		t.Errorf("default proposal has quorum %d and threshold %d", p.QuorumPct, p.ThresholdPct)
+	}
+	if p := proposal(noQuorum); p.QuorumPct != 0 || p.ThresholdPct != 0 {
+		t.Errorf("explicit proposal has quorum %d and threshold %d", p.QuorumPct, p.ThresholdPct)
+	}
+	l.invokeErr("company3", "closeProposal", "{'proposalId':'"+noQuorum+"'}")
+	l.advance(10 * time.Second)
+	l.invokeErr("company2", "vote", "{'proposalId':'"+noQuorum+"','invid':'company2','choice':'no'}")
+	for _, id := range []string{defaults, noQuorum, payExpense} {
+		l.invoke("company4", "closeProposal", "{'proposalId':'"+id+"'}")
+	}
+	if p := proposal(defaults); p.Status != proposalRejected || p.Executed {
+		t.Errorf("default proposal is %s, executed %v", p.Status, p.Executed)
+	}
+	if p := proposal(noQuorum); p.Status != proposalPassed || !p.Executed || l.pty(cusip).Status != statusSuspended {
+		t.Errorf("no quorum proposal is %s, executed %v, and the property is %s", p.Status, p.Executed, l.pty(cusip).Status)
+	}
+
+	// The reserve is empty, so the expense can't be paid but the vote stands
+	if p := proposal(payExpense); p.Status != proposalPassed || p.Executed || p.ActionResult == "" {
+		t.Errorf("pay expense proposal is %s, executed %v, result %q", p.Status, p.Executed, p.ActionResult)
+	}
+
+	var page ProposalPage
+	l.queryJSON(&page, "GetProposals", "{'cusip':'"+cusip+"','status':'Rejected','limit':1}")
+	if len(page.Proposals) != 1 || page.Proposals[0].ProposalID != defaults {
+		t.Errorf("rejected proposals are %+v", page.Proposals)
+	}
+	l.verify()
+}
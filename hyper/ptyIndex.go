@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Index object types for properties, keyed by (type, value, cusip) with the
+// CUSIP as the value. Address values are upper-cased so lookups ignore case.
+// The holder index has an entry for every account that owns or has listed
+// tokens of the property.
+const (
+	ptysByState    = "pty~state"
+	ptysByCity     = "pty~city"
+	ptysByPostcode = "pty~postcode"
+	ptysByIssuer   = "pty~issuer"
+	ptysByHolder   = "pty~holder"
+)
+
+var ptyIndexTypes = []string{ptysByState, ptysByCity, ptysByPostcode, ptysByIssuer, ptysByHolder}
+
+// ptyIndexKeys returns every index key cp should have.
+func ptyIndexKeys(cp PTY) []string {
+	var keys []string
+	add := func(indexType string, value string) {
+		if value != "" {
+			keys = append(keys, compositeKey(indexType, value, cp.CUSIP))
+		}
+	}
+	add(ptysByState, strings.ToUpper(cp.AdrState))
+	add(ptysByCity, strings.ToUpper(cp.AdrCity))
+	add(ptysByPostcode, strings.ToUpper(cp.AdrPostcode))
+	add(ptysByIssuer, cp.Issuer)
+	for _, holder := range holdersOf(cp) {
+		add(ptysByHolder, holder.InvestorID)
+	}
+	return keys
+}
+
+// reindexPTY writes every index key in after and deletes those in before
+// that are no longer wanted. Writing the unchanged keys again means a
+// property saved before the indexes existed is indexed on its next change.
+func reindexPTY(stub StateStub, cusip string, before []string, after []string) error {
+	wanted := map[string]bool{}
+	for _, key := range after {
+		wanted[key] = true
+		err := stub.PutState(key, []byte(cusip))
+		if err != nil {
+			fmt.Println("Error writing index for " + cusip)
+			return errors.New("Error writing index for " + cusip)
+		}
+	}
+	for _, key := range before {
+		if wanted[key] {
+			continue
+		}
+		err := stub.DelState(key)
+		if err != nil {
+			fmt.Println("Error removing index for " + cusip)
+			return errors.New("Error removing index for " + cusip)
+		}
+	}
+	return nil
+}
+
+// indexedCUSIPs returns the CUSIPs filed under value in an index, in CUSIP
+// order.
+func indexedCUSIPs(stub StateStub, indexType string, value string) ([]string, error) {
+	var cusips []string
+	err := scanPrefix(stub, compositeKey(indexType, value), func(key string, cusip []byte) error {
+		cusips = append(cusips, string(cusip))
+		return nil
+	})
+	return cusips, err
+}
+
+// indexPTYs rebuilds the property indexes for every property. It clears
+// each index first, so entries for values a property no longer has are
+// dropped as well as missing ones added.
+func (t *SimpleChaincode) indexPTYs(stub StateStub, args []string) ([]byte, error) {
+	_, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	// Clear every index first so stale entries go too
+	var stale []string
+	for _, indexType := range ptyIndexTypes {
+		err = scanPrefix(stub, compositeKey(indexType), func(key string, value []byte) error {
+			stale = append(stale, key)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range stale {
+		err = stub.DelState(key)
+		if err != nil {
+			return nil, errors.New("Error removing index entry")
+		}
+	}
+
+	properties := 0
+	err = scanPrefix(stub, ptyPrefix, func(key string, value []byte) error {
+		var cp PTY
+		err := json.Unmarshal(value, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling cp " + key)
+			return errors.New("Error unmarshalling cp " + key)
+		}
+		properties++
+		return reindexPTY(stub, cp.CUSIP, nil, ptyIndexKeys(cp))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Indexed %d properties\n", properties)
+	return nil, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexPTYs(t *testing.T) {
+	l := newTestLedger(t)
+	austin := l.setUp()
+	l.invoke("company1", "issuePropertyToken", "{'name':'2 Elm St','adrStreet':'2 Elm St','adrCity':'dallas','adrPostcode':'75201','adrState':'tx','quantity':100,'issuer':'company1','rent':1000,'mktval':100000}")
+	dallas, err := genHash("2 Elm Stdallas75201tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexed := func(indexType string, value string) []string {
+		t.Helper()
+		cusips, err := indexedCUSIPs(l.stub, indexType, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cusips
+	}
+
+	// Address values are filed upper-cased whatever case they were issued in
+	if got := indexed(ptysByCity, "DALLAS"); !reflect.DeepEqual(got, []string{dallas}) {
+		t.Errorf("DALLAS lists %v", got)
+	}
+	if got := indexed(ptysByCity, "dallas"); got != nil {
+		t.Errorf("dallas lists %v", got)
+	}
+	if got := indexed(ptysByState, "TX"); len(got) != 2 {
+		t.Errorf("TX lists %v", got)
+	}
+
+	// The Austin property moves to Houston behind the indexes' back, loses
+	// its issuer entry, and an entry for a property that never existed
+	// appears
+	cp := l.pty(austin)
+	cp.AdrCity = "Houston"
+	l.putJSON(ptyPrefix+austin, cp)
+	l.stub.DelState(compositeKey(ptysByIssuer, "company1", austin))
+	l.stub.PutState(compositeKey(ptysByHolder, "company3", "gone"), []byte("gone"))
+
+	l.invokeErr("company1", "indexPTYs")
+	l.invoke("admin", "indexPTYs")
+
+	tests := []struct {
+		indexType string
+		value     string
+		want      []string
+	}{
+		{ptysByCity, "AUSTIN", nil},
+		{ptysByCity, "HOUSTON", []string{austin}},
+		{ptysByCity, "DALLAS", []string{dallas}},
+		{ptysByPostcode, "75201", []string{dallas}},
+		{ptysByIssuer, "company1", sortedCUSIPs(austin, dallas)},
+		{ptysByHolder, "company1", sortedCUSIPs(austin, dallas)},
+		{ptysByHolder, "company3", nil},
+	}
+	for _, tt := range tests {
+		if got := indexed(tt.indexType, tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %s lists %v, want %v", tt.indexType, tt.value, got, tt.want)
+		}
+	}
+	l.verify()
+}
+
+// sortedCUSIPs is the CUSIPs in the order the indexes list them.
+func sortedCUSIPs(a string, b string) []string {
+	if a < b {
+		return []string{a, b}
+	}
+	return []string{b, a}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var rentPaymentPrefix = "rentpay:"
+
+// Index object types for rent payments. Each entry's key is (type, renter,
+// owner or cusip, padded timestamp, payment ID); a payment is filed under
+// every holder it paid.
+const (
+	rentByRenter = "rentpay~renter"
+	rentByOwner  = "rentpay~owner"
+	rentByCUSIP  = "rentpay~cusip"
+)
+
+// RentPayment is the ledger entry for one processRent call, including what
+// each holder was paid.
+type RentPayment struct {
+	PaymentID     string           `json:"paymentId"`
+	CUSIP         string           `json:"cusip"`
+	Renter        string           `json:"renter"`
+	Amount        Money            `json:"amount"`
+	Reserve       Money            `json:"reserve"`
+	Expenses      []ExpensePayment `json:"expenses"`
+	Distributions []RentShare      `json:"distributions"`
+	TxID          string           `json:"txId"`
+	Timestamp     string           `json:"timestamp"`
+}
+
+// RentShare is one holder's cut of a rent payment. Quantity is what they
+// held, owned plus listed, when the rent was paid.
+type RentShare struct {
+	InvestorID string `json:"invid"`
+	Quantity   int    `json:"quantity"`
+	Amount     Money  `json:"amount"`
+}
+
+type RentQuery struct {
+	Renter string `json:"renter"`
+	Owner  string `json:"owner"`
+	CUSIP  string `json:"cusip"`
+	PageQuery
+}
+
+type RentPaymentPage struct {
+	Payments []RentPayment `json:"payments"`
+	Bookmark string        `json:"bookmark"`
+}
+
+// RentalIncome is an owner's rent income over a period, in total and per
+// property, with the payments it came from.
+type RentalIncome struct {
+	Owner      string           `json:"owner"`
+	From       string           `json:"from"`
+	To         string           `json:"to"`
+	Total      Money            `json:"total"`
+	Properties []PropertyIncome `json:"properties"`
+	Entries    []IncomeEntry    `json:"entries"`
+}
+
+type PropertyIncome struct {
+	CUSIP    string `json:"cusip"`
+	Payments int    `json:"payments"`
+	Amount   Money  `json:"amount"`
+}
+
+type IncomeEntry struct {
+	PaymentID string `json:"paymentId"`
+	CUSIP     string `json:"cusip"`
+	Renter    string `json:"renter"`
+	Quantity  int    `json:"quantity"`
+	Amount    Money  `json:"amount"`
+	Timestamp string `json:"timestamp"`
+}
+
+// recordRentPayment writes the ledger entry for a rent payment and indexes
+// it by renter, by property and by every holder that received a share.
+// split is how distributeRent paid the amount out.
+func recordRentPayment(stub StateStub, cusip string, renter string, amount Money, split RentSplit) (RentPayment, error) {
+	var payment RentPayment
+	now, err := txMillis(stub)
+	if err != nil {
+		return payment, errors.New("Error reading transaction timestamp")
+	}
+
+	payment.PaymentID, err = newRecordID(stub, rentPaymentPrefix)
+	if err != nil {
+		return payment, err
+	}
+	payment.CUSIP = cusip
+	payment.Renter = renter
+	payment.Amount = amount
+	payment.TxID = stub.GetTxID()
+	payment.Timestamp = now
+	payment.Reserve = split.Reserve
+	payment.Expenses = split.Expenses
+	for i, holder := range split.Holders {
+		var share RentShare
+		share.InvestorID = holder.InvestorID
+		share.Quantity = holder.Quantity
+		share.Amount = split.Shares[i]
+		payment.Distributions = append(payment.Distributions, share)
+	}
+
+	paymentBytes, err := json.Marshal(&payment)
+	if err != nil {
+		fmt.Println("Error marshalling rent payment")
+		return payment, errors.New("Error marshalling rent payment")
+	}
+	err = stub.PutState(rentPaymentPrefix+payment.PaymentID, paymentBytes)
+	if err != nil {
+		fmt.Println("Error writing rent payment")
+		return payment, errors.New("Error writing rent payment " + payment.PaymentID)
+	}
+
+	ts := padMillis(now)
+	indexKeys := []string{
+		compositeKey(rentByRenter, renter, ts, payment.PaymentID),
+		compositeKey(rentByCUSIP, cusip, ts, payment.PaymentID),
+	}
+	for _, share := range payment.Distributions {
+		indexKeys = append(indexKeys, compositeKey(rentByOwner, share.InvestorID, ts, payment.PaymentID))
+	}
+	for _, key := range indexKeys {
+		err = stub.PutState(key, []byte(payment.PaymentID))
+		if err != nil {
+			fmt.Println("Error writing rent payment index")
+			return payment, errors.New("Error writing rent payment index for " + payment.PaymentID)
+		}
+	}
+
+	fmt.Println("Recorded rent payment " + payment.PaymentID)
+	return payment, nil
+}
+
+func GetRentPayment(paymentID string, stub StateStub) (RentPayment, error) {
+	var payment RentPayment
+	paymentBytes, err := stub.GetState(rentPaymentPrefix + paymentID)
+	if err != nil || paymentBytes == nil {
+		fmt.Println("Rent payment not found " + paymentID)
+		return payment, errors.New("Rent payment not found " + paymentID)
+	}
+	err = json.Unmarshal(paymentBytes, &payment)
+	if err != nil {
+		fmt.Println("Error unmarshalling rent payment " + paymentID)
+		return payment, errors.New("Error unmarshalling rent payment " + paymentID)
+	}
+	return payment, nil
+}
+
+// GetRentPayments pages through the rent a renter has paid, or the rent paid
+// on a property, oldest first.
+func GetRentPayments(args string, stub StateStub) (RentPaymentPage, error) {
+	var page RentPaymentPage
+	var rq RentQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &rq)
+	if err != nil {
+		return page, errors.New("Invalid rent payment query")
+	}
+
+	var prefix string
+	if rq.Renter != "" {
+		prefix = compositeKey(rentByRenter, rq.Renter)
+	} else if rq.CUSIP != "" {
+		prefix = compositeKey(rentByCUSIP, rq.CUSIP)
+	} else {
+		return page, errors.New("GetRentPayments expects {\"renter\": ...} or {\"cusip\": ...}")
+	}
+
+	bookmark, err := pageIndex(stub, prefix, rq.PageQuery, func(key string, value []byte) error {
+		payment, err := GetRentPayment(string(value), stub)
+		if err != nil {
+			return err
+		}
+		if rq.Renter != "" && rq.CUSIP != "" && payment.CUSIP != rq.CUSIP {
+			return errSkipEntry
+		}
+		page.Payments = append(page.Payments, payment)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+	page.Bookmark = bookmark
+	return page, nil
+}
+
+// GetRentalIncome totals the rent an owner received between from and to,
+// optionally for a single property.
+func GetRentalIncome(args string, stub StateStub) (RentalIncome, error) {
+	var income RentalIncome
+	var rq RentQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &rq)
+	if err != nil || rq.Owner == "" {
+		return income, errors.New("GetRentalIncome expects {\"owner\": ...}")
+	}
+	income.Owner = rq.Owner
+	income.From = rq.From
+	income.To = rq.To
+
+	prefix := compositeKey(rentByOwner, rq.Owner)
+	startKey := prefix
+	if rq.From != "" {
+		startKey = prefix + padMillis(rq.From)
+	}
+	endKey := prefix + "\xff"
+	if rq.To != "" {
+		endKey = prefix + padMillis(rq.To) + "\x00\xff"
+	}
+
+	err = scanRange(stub, startKey, endKey, func(key string, value []byte) error {
+		payment, err := GetRentPayment(string(value), stub)
+		if err != nil {
+			return err
+		}
+		if rq.CUSIP != "" && payment.CUSIP != rq.CUSIP {
+			return nil
+		}
+		for _, share := range payment.Distributions {
+			if share.InvestorID != rq.Owner {
+				continue
+			}
+			var entry IncomeEntry
+			entry.PaymentID = payment.PaymentID
+			entry.CUSIP = payment.CUSIP
+			entry.Renter = payment.Renter
+			entry.Quantity = share.Quantity
+			entry.Amount = share.Amount
+			entry.Timestamp = payment.Timestamp
+			income.Entries = append(income.Entries, entry)
+			income.Total += share.Amount
+
+			found := false
+			for i := range income.Properties {
+				if income.Properties[i].CUSIP == payment.CUSIP {
+					income.Properties[i].Payments++
+					income.Properties[i].Amount += share.Amount
+					found = true
+				}
+			}
+			if !found {
+				income.Properties = append(income.Properties, PropertyIncome{CUSIP: payment.CUSIP, Payments: 1, Amount: share.Amount})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return income, err
+	}
+	return income, nil
+}
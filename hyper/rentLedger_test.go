@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRentLedger(t *testing.T) {
+	l := newTestLedger(t)
+	first := l.setUp()
+	second := l.issue("company1", "2 Main St", 100)
+	l.invoke("company1", "createLease", "{'cusip':'"+first+"','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':0,'start':'0','end':'31536000000'}")
+	l.invoke("company1", "createLease", "{'cusip':'"+second+"','tenant':'company4','unit':'2A','monthlyRent':1000,'deposit':0,'start':'0','end':'31536000000'}")
+	l.invoke("company1", "setForSale", "{'cusip':'"+first+"','fromCompany':'company1','quantity':20,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+first+"','fromCompany':'company1','toCompany':'company2','quantity':20}")
+
+	// Rent on the first property, then the second, then the first again
+	var paid []string
+	for _, cusip := range []string{first, second, first} {
+		l.advance(time.Second)
+		paid = append(paid, l.millis())
+		l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4'}")
+	}
+
+	// The second payment is company4's only one for the second property,
+	// and the first payment it passes over doesn't use up the page
+	var page RentPaymentPage
+	l.queryJSON(&page, "GetRentPayments", "{'renter':'company4','cusip':'"+second+"','limit':1}")
+	if len(page.Payments) != 1 || page.Payments[0].CUSIP != second || page.Payments[0].Timestamp != paid[1] {
+		t.Errorf("company4's payments for the second property are %+v", page.Payments)
+	}
+	l.queryJSON(&page, "GetRentPayments", "{'cusip':'"+first+"'}")
+	if len(page.Payments) != 2 || page.Bookmark != "" {
+		t.Errorf("the first property has %d payments", len(page.Payments))
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		total    Money
+		entries  int
+		perCUSIP map[string]Money
+		wantErr  bool
+	}{
+		{"every payment", "{'owner':'company1'}", 80000 + 100000 + 80000, 3, map[string]Money{first: 160000, second: 100000}, false},
+		{"one property", "{'owner':'company1','cusip':'" + second + "'}", 100000, 1, map[string]Money{second: 100000}, false},
+		{"from the second payment", "{'owner':'company1','from':'" + paid[1] + "'}", 100000 + 80000, 2, map[string]Money{first: 80000, second: 100000}, false},
+		{"up to the second payment", "{'owner':'company1','to':'" + paid[1] + "'}", 80000 + 100000, 2, map[string]Money{first: 80000, second: 100000}, false},
+		{"a minority holder", "{'owner':'company2'}", 20000 + 20000, 2, map[string]Money{first: 40000}, false},
+		{"no owner", "{'cusip':'" + first + "'}", 0, 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			if tt.wantErr {
+				_, err := l.stub.MockQuery(l.cc, "query", []string{"GetRentalIncome", tt.query})
+				if err == nil {
+					t.Error("should have failed")
+				}
+				return
+			}
+			var income RentalIncome
+			l.queryJSON(&income, "GetRentalIncome", tt.query)
+			if income.Total != tt.total || len(income.Entries) != tt.entries || len(income.Properties) != len(tt.perCUSIP) {
+				t.Fatalf("income is %s over %d entries and %d properties", income.Total, len(income.Entries), len(income.Properties))
+			}
+			for _, property := range income.Properties {
+				if property.Amount != tt.perCUSIP[property.CUSIP] {
+					t.Errorf("%s paid %s, want %s", property.CUSIP, property.Amount, tt.perCUSIP[property.CUSIP])
+				}
+			}
+		})
+	}
+	l.t = t
+	l.verify()
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var capitalCallPrefix = "capcall:"
+
+// Index object types for capital calls. Each entry's key is (type, cusip or
+// holder, padded timestamp, call ID), so a holder can page through every
+// call made on them.
+const (
+	callsByCUSIP  = "capcall~cusip"
+	callsByHolder = "capcall~holder"
+)
+
+// CapitalCall asks a property's holders to pay into its reserve, pro rata to
+// what they hold. Whatever a holder couldn't pay is their shortfall until
+// they pay it with payShortfall.
+type CapitalCall struct {
+	CallID        string         `json:"callId"`
+	CUSIP         string         `json:"cusip"`
+	Amount        Money          `json:"amount"`
+	Reason        string         `json:"reason"`
+	Collected     Money          `json:"collected"`
+	Shortfall     Money          `json:"shortfall"`
+	Contributions []Contribution `json:"contributions"`
+	CalledBy      string         `json:"calledBy"`
+	Called        string         `json:"called"`
+}
+
+// Contribution is one holder's part of a capital call.
+type Contribution struct {
+	InvestorID string `json:"invid"`
+	Quantity   int    `json:"quantity"`
+	Due        Money  `json:"due"`
+	Paid       Money  `json:"paid"`
+}
+
+type PayFromReserve struct {
+	ExpenseID string `json:"expenseId"`
+	Amount    Money  `json:"amount"`
+}
+
+type MakeCapitalCall struct {
+	CUSIP  string `json:"cusip"`
+	Amount Money  `json:"amount"`
+	Reason string `json:"reason"`
+}
+
+type PayShortfall struct {
+	CallID     string `json:"callId"`
+	InvestorID string `json:"invid"`
+	Amount     Money  `json:"amount"`
+}
+
+type CapitalCallQuery struct {
+	CUSIP         string `json:"cusip"`
+	InvestorID    string `json:"invid"`
+	ShortfallOnly bool   `json:"shortfallOnly"`
+	PageQuery
+}
+
+type CapitalCallPage struct {
+	Calls    []CapitalCall `json:"calls"`
+	Bookmark string        `json:"bookmark"`
+}
+
+// payFromReserve is the admin approving an outstanding expense to be paid
+// out of its property's reserve. Without an amount it pays as much of the
+// expense as the reserve covers.
+func (t *SimpleChaincode) payFromReserve(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting reserve payment record")
+	}
+
+	var pr PayFromReserve
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &pr)
+	if err != nil {
+		fmt.Println("Error Unmarshalling PayFromReserve")
+		return nil, errors.New("Invalid reserve payment record")
+	}
+
+	approver, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	expense, err := GetExpense(pr.ExpenseID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if expense.Status != expenseOutstanding {
+		return nil, errors.New("Expense " + expense.ExpenseID + " is " + expense.Status)
+	}
+	cp, err := GetPTY(expense.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	owed := expense.Amount - expense.Paid
+	amount := pr.Amount
+	if amount == 0 {
+		amount = owed
+		if cp.Reserve < amount {
+			amount = cp.Reserve
+		}
+	}
+	if amount <= 0 || amount > owed {
+		return nil, errors.New("Reserve payment must be positive and no more than the " + owed.String() + " owed")
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	err = payFromReserveOf(stub, &cp, expense, amount, approver.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// payFromReserveOf pays amount of an expense out of cp's reserve on
+// approver's say so. cp is only changed in memory.
+func payFromReserveOf(stub StateStub, cp *PTY, expense Expense, amount Money, approver string, now string) error {
+	if amount > cp.Reserve {
+		return errors.New("The reserve of " + cp.CUSIP + " only holds " + cp.Reserve.String())
+	}
+
+	expense.ApprovedBy = approver
+	err := payExpense(stub, &expense, amount, now)
+	if err != nil {
+		return err
+	}
+
+	cp.Reserve -= amount
+	if expense.Status == expensePaid {
+		var open []string
+		for _, expenseID := range cp.OpenExpenses {
+			if expenseID != expense.ExpenseID {
+				open = append(open, expenseID)
+			}
+		}
+		cp.OpenExpenses = open
+	}
+
+	fmt.Println("Paid " + amount.String() + " of expense " + expense.ExpenseID + " from reserve")
+	return nil
+}
+
+// capitalCall charges a property's holders amount between them, by quantity
+// held, into its reserve. Holders pay what their cash covers and the rest is
+// recorded as their shortfall. Only the property's issuer can make a call.
+func (t *SimpleChaincode) capitalCall(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting capital call record")
+	}
+
+	var mc MakeCapitalCall
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &mc)
+	if err != nil {
+		fmt.Println("Error Unmarshalling MakeCapitalCall")
+		return nil, errors.New("Invalid capital call record")
+	}
+	if mc.Amount <= 0 {
+		return nil, errors.New("Capital call amount must be positive")
+	}
+
+	cp, err := GetPTY(mc.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	err = requirePropertyIssuer(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	if hasStatus(cp, statusDelisted, statusSold) {
+		return nil, errors.New("Property " + cp.CUSIP + " is " + cp.Status)
+	}
+
+	holders := holdersOf(cp)
+	if len(holders) == 0 {
+		return nil, errors.New("Property " + cp.CUSIP + " has no holders to call on")
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	var call CapitalCall
+	call.CallID, err = newRecordID(stub, capitalCallPrefix)
+	if err != nil {
+		return nil, err
+	}
+	call.CUSIP = cp.CUSIP
+	call.Amount = mc.Amount
+	call.Reason = mc.Reason
+	call.CalledBy = caller.ID
+	call.Called = now
+
+	var quantities []int
+	for _, holder := range holders {
+		quantities = append(quantities, holder.Quantity)
+	}
+	dues := mc.Amount.Allocate(quantities)
+
+	for i, holder := range holders {
+		account, err := GetCompany(holder.InvestorID, stub)
+		if err != nil {
+			return nil, err
+		}
+		paid := dues[i]
+		if account.CashBalance < paid {
+			paid = account.CashBalance
+		}
+		if paid < 0 {
+			paid = 0
+		}
+		account.CashBalance -= paid
+		err = putCompany(stub, account)
+		if err != nil {
+			return nil, err
+		}
+
+		call.Contributions = append(call.Contributions, Contribution{InvestorID: holder.InvestorID, Quantity: holder.Quantity, Due: dues[i], Paid: paid})
+		call.Collected += paid
+		call.Shortfall += dues[i] - paid
+		if paid < dues[i] {
+			fmt.Println(holder.InvestorID + " is short " + (dues[i] - paid).String() + " on capital call " + call.CallID)
+		}
+	}
+
+	err = putCapitalCall(stub, call)
+	if err != nil {
+		return nil, err
+	}
+	ts := padMillis(now)
+	indexKeys := []string{compositeKey(callsByCUSIP, cp.CUSIP, ts, call.CallID)}
+	for _, contribution := range call.Contributions {
+		indexKeys = append(indexKeys, compositeKey(callsByHolder, contribution.InvestorID, ts, call.CallID))
+	}
+	for _, key := range indexKeys {
+		err = stub.PutState(key, []byte(call.CallID))
+		if err != nil {
+			return nil, errors.New("Error writing capital call index for " + call.CallID)
+		}
+	}
+
+	cp.Reserve += call.Collected
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Capital call " + call.CallID + " collected " + call.Collected.String())
+	return []byte(call.CallID), nil
+}
+
+// payShortfall lets a holder pay what they still owe on a capital call.
+// Without an amount they pay all of it.
+func (t *SimpleChaincode) payShortfall(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting shortfall payment record")
+	}
+
+	var ps PayShortfall
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &ps)
+	if err != nil {
+		fmt.Println("Error Unmarshalling PayShortfall")
+		return nil, errors.New("Invalid shortfall payment record")
+	}
+
+	account, err := requireCaller(stub, ps.InvestorID, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	call, err := GetCapitalCall(ps.CallID, stub)
+	if err != nil {
+		return nil, err
+	}
+	found := -1
+	for i, contribution := range call.Contributions {
+		if contribution.InvestorID == account.ID {
+			found = i
+		}
+	}
+	if found == -1 {
+		return nil, errors.New(account.ID + " was not called on in " + call.CallID)
+	}
+
+	owed := call.Contributions[found].Due - call.Contributions[found].Paid
+	amount := ps.Amount
+	if amount == 0 {
+		amount = owed
+	}
+	if amount <= 0 || amount > owed {
+		return nil, errors.New("Payment must be positive and no more than the " + owed.String() + " short")
+	}
+	if account.CashBalance < amount {
+		return nil, errors.New("The company " + account.ID + " doesn't have enough cash")
+	}
+
+	cp, err := GetPTY(call.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	if hasStatus(cp, statusDelisted, statusSold) {
+		return nil, errors.New("Property " + cp.CUSIP + " is " + cp.Status)
+	}
+
+	account.CashBalance -= amount
+	err = putCompany(stub, account)
+	if err != nil {
+		return nil, err
+	}
+
+	call.Contributions[found].Paid += amount
+	call.Collected += amount
+	call.Shortfall -= amount
+	err = putCapitalCall(stub, call)
+	if err != nil {
+		return nil, err
+	}
+
+	cp.Reserve += amount
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func putCapitalCall(stub StateStub, call CapitalCall) error {
+	callBytes, err := json.Marshal(&call)
+	if err != nil {
+		fmt.Println("Error marshalling capital call " + call.CallID)
+		return errors.New("Error marshalling capital call " + call.CallID)
+	}
+	err = stub.PutState(capitalCallPrefix+call.CallID, callBytes)
+	if err != nil {
+		fmt.Println("Error writing capital call " + call.CallID)
+		return errors.New("Error writing capital call " + call.CallID)
+	}
+	return nil
+}
+
+func GetCapitalCall(callID string, stub StateStub) (CapitalCall, error) {
+	var call CapitalCall
+	callBytes, err := stub.GetState(capitalCallPrefix + callID)
+	if err != nil || callBytes == nil {
+		fmt.Println("Capital call not found " + callID)
+		return call, errors.New("Capital call not found " + callID)
+	}
+	err = json.Unmarshal(callBytes, &call)
+	if err != nil {
+		fmt.Println("Error unmarshalling capital call " + callID)
+		return call, errors.New("Error unmarshalling capital call " + callID)
+	}
+	return call, nil
+}
+
+// GetCapitalCalls pages through the capital calls on a property, or those a
+// holder was called on, oldest first. With shortfallOnly it skips calls that
+// are paid up, or for a holder, calls where they are paid up.
+func GetCapitalCalls(args string, stub StateStub) (CapitalCallPage, error) {
+	var page CapitalCallPage
+	var cq CapitalCallQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &cq)
+	if err != nil {
+		return page, errors.New("Invalid capital call query")
+	}
+
+	var prefix string
+	if cq.InvestorID != "" {
+		prefix = compositeKey(callsByHolder, cq.InvestorID)
+	} else if cq.CUSIP != "" {
+		prefix = compositeKey(callsByCUSIP, cq.CUSIP)
+	} else {
+		return page, errors.New("GetCapitalCalls expects {\"cusip\": ...} or {\"invid\": ...}")
+	}
+
+	bookmark, err := pageIndex(stub, prefix, cq.PageQuery, func(key string, value []byte) error {
+		call, err := GetCapitalCall(string(value), stub)
+		if err != nil {
+			return err
+		}
+		if cq.InvestorID != "" && cq.CUSIP != "" && call.CUSIP != cq.CUSIP {
+			return errSkipEntry
+		}
+		if cq.ShortfallOnly {
+			short := call.Shortfall
+			if cq.InvestorID != "" {
+				short = 0
+				for _, contribution := range call.Contributions {
+					if contribution.InvestorID == cq.InvestorID {
+						short = contribution.Due - contribution.Paid
+					}
+				}
+			}
+			if short == 0 {
+				return errSkipEntry
+			}
+		}
+		page.Calls = append(page.Calls, call)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+	page.Bookmark = bookmark
+	return page, nil
+}
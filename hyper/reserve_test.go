@@ -0,0 +1,92 @@
+package main
+
+import "testing"
+
+func TestPayFromReserve(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':0,'start':'0','end':'31536000000'}")
+	l.invoke("company1", "setDistribution", "{'cusip':'"+cusip+"','mode':'gross','reservePct':50}")
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4'}")
+	repairs := string(l.invoke("company1", "recordExpense", "{'cusip':'"+cusip+"','category':'repairs','amount':300,'payee':'company2'}"))
+	roof := string(l.invoke("company1", "recordExpense", "{'cusip':'"+cusip+"','category':'repairs','description':'roof','amount':500,'payee':'company2'}"))
+
+	l.invokeErr("company1", "payFromReserve", "{'expenseId':'"+repairs+"'}")
+	l.invokeErr("admin", "payFromReserve", "{'expenseId':'"+repairs+"','amount':301}")
+
+	payeeCash := l.cash("company2")
+	l.invoke("admin", "payFromReserve", "{'expenseId':'"+repairs+"'}")
+	l.invokeErr("admin", "payFromReserve", "{'expenseId':'"+repairs+"'}")
+	if cp := l.pty(cusip); cp.Reserve != 20000 || len(cp.OpenExpenses) != 1 || cp.OpenExpenses[0] != roof {
+		t.Fatalf("reserve is %s with open expenses %v", cp.Reserve, cp.OpenExpenses)
+	}
+	if got := l.cash("company2") - payeeCash; got != 30000 {
+		t.Errorf("company2 was paid %s, want 300.00", got)
+	}
+
+	// The reserve only covers 200 of the 500 roof
+	l.invoke("admin", "payFromReserve", "{'expenseId':'"+roof+"'}")
+	expense, _ := GetExpense(roof, l.stub)
+	if cp := l.pty(cusip); cp.Reserve != 0 || len(cp.OpenExpenses) != 1 || expense.Status != expenseOutstanding || expense.Paid != 20000 {
+		t.Errorf("reserve is %s and the roof expense is %+v", cp.Reserve, expense)
+	}
+	l.invokeErr("admin", "payFromReserve", "{'expenseId':'"+roof+"','amount':1}")
+	l.verify()
+}
+
+func TestCapitalCall(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':0,'start':'0','end':'31536000000'}")
+
+	// company2 spends 8000000.00 of its 10000000.00 on 20 tokens
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':20,'sellval':400000}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':20}")
+
+	l.invokeErr("company2", "capitalCall", "{'cusip':'"+cusip+"','amount':1000}")
+	l.invokeErr("company1", "capitalCall", "{'cusip':'"+cusip+"','amount':0}")
+
+	// A call everyone can pay, then one where company2 owes a fifth of
+	// 20000000.00 and only has 1999999.80 left
+	l.invoke("company1", "capitalCall", "{'cusip':'"+cusip+"','amount':1}")
+	call := string(l.invoke("company1", "capitalCall", "{'cusip':'"+cusip+"','amount':20000000,'reason':'roof'}"))
+	var page CapitalCallPage
+	l.queryJSON(&page, "GetCapitalCalls", "{'cusip':'"+cusip+"'}")
+	if len(page.Calls) != 2 || page.Calls[1].Collected != 1799999980 || page.Calls[1].Shortfall != 200000020 {
+		t.Fatalf("capital calls are %+v", page.Calls)
+	}
+	if cp := l.pty(cusip); cp.Reserve != 1800000080 {
+		t.Fatalf("reserve is %s, want 18000000.80", cp.Reserve)
+	}
+	if got := l.cash("company2"); got != 0 {
+		t.Fatalf("company2 has %s left, want 0.00", got)
+	}
+
+	// The paid up call is left out before the limit is counted
+	l.queryJSON(&page, "GetCapitalCalls", "{'invid':'company2','shortfallOnly':true,'limit':1}")
+	if len(page.Calls) != 1 || page.Calls[0].CallID != call {
+		t.Errorf("company2's shortfalls are %+v", page.Calls)
+	}
+
+	// Rent gives company2 200.00 to pay down its shortfall with
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4'}")
+	l.invokeErr("company3", "payShortfall", "{'callId':'"+call+"','invid':'company2','amount':100}")
+	l.invokeErr("company3", "payShortfall", "{'callId':'"+call+"','invid':'company3','amount':100}")
+	l.invokeErr("company2", "payShortfall", "{'callId':'"+call+"','invid':'company2','amount':2000001}")
+	l.invokeErr("company2", "payShortfall", "{'callId':'"+call+"','invid':'company2'}")
+	l.invoke("company2", "payShortfall", "{'callId':'"+call+"','invid':'company2','amount':150}")
+	if cp := l.pty(cusip); cp.Reserve != 1800000080+15000 {
+		t.Errorf("reserve is %s after the payment", cp.Reserve)
+	}
+	l.queryJSON(&page, "GetCapitalCalls", "{'invid':'company2','shortfallOnly':true}")
+	if len(page.Calls) != 1 || page.Calls[0].Shortfall != 200000020-15000 {
+		t.Errorf("company2's shortfalls are %+v", page.Calls)
+	}
+	l.verify()
+
+	for _, status := range []string{statusDelisted, statusSold} {
+		l.forceStatus(cusip, status)
+		l.invokeErr("company1", "capitalCall", "{'cusip':'"+cusip+"','amount':1000}")
+		l.invokeErr("company2", "payShortfall", "{'callId':'"+call+"','invid':'company2','amount':10}")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PropertySale records how a sold property was paid out. Distributions are
+// the holders' shares of the proceeds after expenses, including the reserve.
+type PropertySale struct {
+	ProposalID    string           `json:"proposalId"`
+	Buyer         string           `json:"buyer"`
+	Price         Money            `json:"price"`
+	Reserve       Money            `json:"reserve"`
+	Expenses      []ExpensePayment `json:"expenses"`
+	Distributions []RentShare      `json:"distributions"`
+	Quantity      int              `json:"quantity"`
+	Date          string           `json:"date"`
+}
+
+type SellProperty struct {
+	ProposalID string `json:"proposalId"`
+	Buyer      string `json:"buyer"`
+}
+
+// sellProperty completes a sale the holders voted for. The buyer named in
+// the passed proposal pays the price. Open bids, listings and leases are
+// closed, outstanding expenses are paid, and the rest of the proceeds and the
+// reserve go to the holders by quantity held. The tokens are then burned and
+// the property is Sold for good.
+func (t *SimpleChaincode) sellProperty(stub StateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting sale record")
+	}
+
+	var sp SellProperty
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &sp)
+	if err != nil {
+		fmt.Println("Error Unmarshalling SellProperty")
+		return nil, errors.New("Invalid sale record")
+	}
+
+	buyer, err := requireCaller(stub, sp.Buyer, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal, err := GetProposal(sp.ProposalID, stub)
+	if err != nil {
+		return nil, err
+	}
+	if proposal.Status != proposalPassed || proposal.Action.Type != actionSell {
+		return nil, errors.New("Proposal " + proposal.ProposalID + " is not a passed sale")
+	}
+	if proposal.Executed {
+		return nil, errors.New("The sale in proposal " + proposal.ProposalID + " has already been completed")
+	}
+	if proposal.Action.Buyer != buyer.ID {
+		return nil, errors.New("Proposal " + proposal.ProposalID + " sells to " + proposal.Action.Buyer)
+	}
+
+	cp, err := GetPTY(proposal.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+	now, err := txMillis(stub)
+	if err != nil {
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+	price := proposal.Action.Amount
+	err = setStatus(&cp, statusSold, buyer.ID, "Sold to "+buyer.ID+" by proposal "+proposal.ProposalID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if buyer.CashBalance < price {
+		fmt.Println("The company " + buyer.ID + " doesn't have enough cash to buy " + cp.CUSIP)
+		return nil, errors.New("The company " + buyer.ID + " doesn't have enough cash to buy " + cp.CUSIP)
+	}
+	buyer.CashBalance -= price
+	err = putCompany(stub, buyer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tenants leave with their whole deposit
+	renters := cp.Renters
+	for _, renter := range renters {
+		lease, err := GetLease(renter.LeaseID, stub)
+		if err != nil {
+			return nil, err
+		}
+		err = closeLease(stub, &cp, lease, now, TerminateLease{LeaseID: lease.LeaseID, Reason: "Property sold"})
+		if err != nil {
+			return nil, err
+		}
+	}
+	cp.Bids = nil
+	cp.Offering = nil
+
+	var sale PropertySale
+	sale.ProposalID = proposal.ProposalID
+	sale.Buyer = buyer.ID
+	sale.Price = price
+	sale.Reserve = cp.Reserve
+	sale.Date = now
+	for _, holder := range holdersOf(cp) {
+		sale.Quantity += holder.Quantity
+	}
+
+	proceeds := price + cp.Reserve
+	cp.Reserve = 0
+	sale.Expenses, proceeds, err = payOpenExpenses(stub, &cp, proceeds)
+	if err != nil {
+		return nil, err
+	}
+	holders, shares, err := creditHolders(stub, cp, proceeds)
+	if err != nil {
+		return nil, err
+	}
+	for i, holder := range holders {
+		sale.Distributions = append(sale.Distributions, RentShare{InvestorID: holder.InvestorID, Quantity: holder.Quantity, Amount: shares[i]})
+	}
+
+	// Burn the tokens
+	cp.Owners = nil
+	cp.PT4Sale = nil
+	cp.Qty = 0
+	cp.Sale = &sale
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal.Executed = true
+	proposal.ActionResult = "Sold"
+	err = putProposal(stub, proposal)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Sold " + cp.CUSIP + " to " + buyer.ID + " for " + price.String())
+	return nil, nil
+}
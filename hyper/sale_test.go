@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSellProperty(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	lease := string(l.invoke("company1", "createLease", "{'cusip':'"+cusip+"','tenant':'company4','unit':'1A','monthlyRent':1000,'deposit':500,'start':'0','end':'31536000000'}"))
+	l.invoke("company4", "acceptLease", "{'leaseId':'"+lease+"'}")
+	l.invoke("company1", "setDistribution", "{'cusip':'"+cusip+"','mode':'gross','reservePct':10}")
+	l.invoke("company4", "processRent", "{'cusip':'"+cusip+"','issuer':'company4'}")
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+cusip+"','fromCompany':'company1','toCompany':'company2','quantity':30}")
+	l.invoke("company3", "placeBid", "{'cusip':'"+cusip+"','invid':'company3','quantity':5,'limitPrice':9}")
+	l.invoke("company1", "recordExpense", "{'cusip':'"+cusip+"','category':'repairs','amount':300,'payee':'company4'}")
+
+	closes := strconv.FormatInt(l.stub.TxTime.Add(10*time.Second).UnixNano()/nanosPerMillisecond, 10)
+	proposal := string(l.invoke("company2", "propose", "{'cusip':'"+cusip+"','invid':'company2','closes':'"+closes+"','title':'sell','action':{'type':'sell','buyer':'company3','amount':50000}}"))
+	l.invokeErr("company3", "sellProperty", "{'proposalId':'"+proposal+"','buyer':'company3'}")
+	l.invoke("company1", "vote", "{'proposalId':'"+proposal+"','invid':'company1','choice':'yes'}")
+	l.invoke("company2", "vote", "{'proposalId':'"+proposal+"','invid':'company2','choice':'yes'}")
+	l.invoke("company2", "closeProposal", "{'proposalId':'"+proposal+"'}")
+
+	// Only the buyer in the proposal can complete it
+	l.invokeErr("company4", "sellProperty", "{'proposalId':'"+proposal+"','buyer':'company4'}")
+	l.invokeErr("company2", "sellProperty", "{'proposalId':'"+proposal+"','buyer':'company3'}")
+
+	before := map[string]Money{}
+	for _, id := range []string{"company1", "company2", "company3", "company4"} {
+		before[id] = l.cash(id)
+	}
+	l.invoke("company3", "sellProperty", "{'proposalId':'"+proposal+"','buyer':'company3'}")
+	l.invokeErr("company3", "sellProperty", "{'proposalId':'"+proposal+"','buyer':'company3'}")
+
+	// 50000 plus the 100 reserve, less the 300 expense, split 70/30
+	wantCash := []struct {
+		investorID string
+		change     Money
+	}{
+		{"company1", 3486000},
+		{"company2", 1494000},
+		{"company3", -5000000},
+		{"company4", 30000 + 50000},
+	}
+	for _, want := range wantCash {
+		if got := l.cash(want.investorID) - before[want.investorID]; got != want.change {
+			t.Errorf("%s's cash changed by %s, want %s", want.investorID, got, want.change)
+		}
+	}
+
+	cp := l.pty(cusip)
+	if cp.Status != statusSold || cp.Qty != 0 || len(cp.Owners) != 0 || len(cp.PT4Sale) != 0 || len(cp.Bids) != 0 {
+		t.Errorf("after the sale the property is %s with %d tokens, owners %+v, listings %+v and bids %+v", cp.Status, cp.Qty, cp.Owners, cp.PT4Sale, cp.Bids)
+	}
+	if cp.Reserve != 0 || len(cp.OpenExpenses) != 0 || len(cp.Renters) != 0 {
+		t.Errorf("after the sale the reserve is %s, open expenses %v and renters %+v", cp.Reserve, cp.OpenExpenses, cp.Renters)
+	}
+	sale := cp.Sale
+	if sale == nil || sale.Price != 5000000 || sale.Reserve != 10000 || sale.Quantity != 100 || len(sale.Expenses) != 1 || len(sale.Distributions) != 2 {
+		t.Fatalf("sale is recorded as %+v", sale)
+	}
+	if sale.Distributions[0].Amount+sale.Distributions[1].Amount != 4980000 {
+		t.Errorf("holders were paid %+v", sale.Distributions)
+	}
+
+	var terminated Lease
+	l.queryJSON(&terminated, "GetLease", lease)
+	if terminated.Status != leaseTerminated || terminated.DepositReturned != 50000 {
+		t.Errorf("lease is %s with %s of the deposit returned", terminated.Status, terminated.DepositReturned)
+	}
+	var p Proposal
+	l.queryJSON(&p, "GetProposal", proposal)
+	if !p.Executed {
+		t.Errorf("proposal is %+v", p)
+	}
+
+	l.invokeErr("company2", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company2','quantity':1,'sellval':10}")
+	l.verify()
+}
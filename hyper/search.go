@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Fields SearchPTYs can sort by. Ties are broken by CUSIP.
+const (
+	sortByCUSIP     = "cusip"
+	sortByName      = "name"
+	sortByMktValue  = "mktval"
+	sortByRent      = "rent"
+	sortByIssueDate = "issueDate"
+)
+
+var ptySortFields = []string{sortByCUSIP, sortByName, sortByMktValue, sortByRent, sortByIssueDate}
+
+// PTYQuery filters properties for SearchPTYs. Blank strings and zero amounts
+// match everything; address fields match ignoring case. Holder matches the
+// properties an account owns or has listed tokens of.
+type PTYQuery struct {
+	AdrCity     string `json:"adrCity"`
+	AdrState    string `json:"adrState"`
+	AdrPostcode string `json:"adrPostcode"`
+	Status      string `json:"status"`
+	Issuer      string `json:"issuer"`
+	Holder      string `json:"holder"`
+	MinMktValue Money  `json:"minMktval"`
+	MaxMktValue Money  `json:"maxMktval"`
+	MinRent     Money  `json:"minRent"`
+	MaxRent     Money  `json:"maxRent"`
+	HasListings bool   `json:"hasListings"`
+	Sort        string `json:"sort"`
+	Desc        bool   `json:"desc"`
+	Bookmark    string `json:"bookmark"`
+	Limit       int    `json:"limit"`
+}
+
+type PTYPage struct {
+	PTYs     []PTY  `json:"ptys"`
+	Bookmark string `json:"bookmark"`
+}
+
+// SearchPTYs returns a page of the properties matching every filter in the
+// query, in the order asked for. The bookmark is the sort position of the
+// last property returned, so properties issued between pages don't shift
+// the pages that follow.
+func SearchPTYs(args string, stub StateStub) (PTYPage, error) {
+	var page PTYPage
+	var q PTYQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &q)
+	if err != nil {
+		return page, errors.New("SearchPTYs expects a property query record")
+	}
+	if q.Sort == "" {
+		q.Sort = sortByCUSIP
+	}
+	if !validPTYSort(q.Sort) {
+		return page, errors.New("SearchPTYs can sort by " + strings.Join(ptySortFields, ", "))
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	var matches []PTY
+	keep := func(cp PTY) {
+		if matchesPTY(cp, q) {
+			matches = append(matches, cp)
+		}
+	}
+	indexType, value := searchIndex(q)
+	if indexType != "" {
+		cusips, err := indexedCUSIPs(stub, indexType, value)
+		if err != nil {
+			return page, err
+		}
+		for _, cusip := range cusips {
+			cp, err := GetPTY(cusip, stub)
+			if err != nil {
+				return page, err
+			}
+			keep(cp)
+		}
+	} else {
+		err = scanPrefix(stub, ptyPrefix, func(key string, value []byte) error {
+			var cp PTY
+			err := json.Unmarshal(value, &cp)
+			if err != nil {
+				fmt.Println("Error unmarshalling " + key)
+				return errors.New("Error unmarshalling " + key)
+			}
+			keep(cp)
+			return nil
+		})
+		if err != nil {
+			return page, err
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := ptySortKey(matches[i], q.Sort), ptySortKey(matches[j], q.Sort)
+		if q.Desc {
+			return a > b
+		}
+		return a < b
+	})
+
+	for _, cp := range matches {
+		position := ptySortKey(cp, q.Sort)
+		if q.Bookmark != "" && (q.Desc && position >= q.Bookmark || !q.Desc && position <= q.Bookmark) {
+			continue
+		}
+		if len(page.PTYs) == limit {
+			page.Bookmark = ptySortKey(page.PTYs[limit-1], q.Sort)
+			break
+		}
+		page.PTYs = append(page.PTYs, cp)
+	}
+	return page, nil
+}
+
+// searchIndex picks the index that narrows q down the most, or "" when no
+// indexed filter is set and every property has to be read.
+func searchIndex(q PTYQuery) (string, string) {
+	switch {
+	case q.Holder != "":
+		return ptysByHolder, q.Holder
+	case q.Issuer != "":
+		return ptysByIssuer, q.Issuer
+	case q.AdrPostcode != "":
+		return ptysByPostcode, strings.ToUpper(q.AdrPostcode)
+	case q.AdrCity != "":
+		return ptysByCity, strings.ToUpper(q.AdrCity)
+	case q.AdrState != "":
+		return ptysByState, strings.ToUpper(q.AdrState)
+	}
+	return "", ""
+}
+
+// matchesPTY is whether cp passes every filter in q.
+func matchesPTY(cp PTY, q PTYQuery) bool {
+	if q.AdrCity != "" && !strings.EqualFold(cp.AdrCity, q.AdrCity) {
+		return false
+	}
+	if q.AdrState != "" && !strings.EqualFold(cp.AdrState, q.AdrState) {
+		return false
+	}
+	if q.AdrPostcode != "" && !strings.EqualFold(cp.AdrPostcode, q.AdrPostcode) {
+		return false
+	}
+	if q.Status != "" && cp.Status != q.Status {
+		return false
+	}
+	if q.Issuer != "" && cp.Issuer != q.Issuer {
+		return false
+	}
+	if q.Holder != "" {
+		held := false
+		for _, holder := range holdersOf(cp) {
+			if holder.InvestorID == q.Holder {
+				held = true
+			}
+		}
+		if !held {
+			return false
+		}
+	}
+	if cp.MktValue < q.MinMktValue || (q.MaxMktValue > 0 && cp.MktValue > q.MaxMktValue) {
+		return false
+	}
+	if cp.Rent < q.MinRent || (q.MaxRent > 0 && cp.Rent > q.MaxRent) {
+		return false
+	}
+	if q.HasListings {
+		listed := false
+		for _, forsale := range cp.PT4Sale {
+			if forsale.Quantity > 0 {
+				listed = true
+			}
+		}
+		if !listed {
+			return false
+		}
+	}
+	return true
+}
+
+// ptySortKey is a string that orders properties by field the way the field's
+// values order, followed by the CUSIP so every key is unique.
+func ptySortKey(cp PTY, field string) string {
+	var value string
+	switch field {
+	case sortByName:
+		value = cp.Name
+	case sortByMktValue:
+		value = fmt.Sprintf("%020d", int64(cp.MktValue))
+	case sortByRent:
+		value = fmt.Sprintf("%020d", int64(cp.Rent))
+	case sortByIssueDate:
+		value = padMillis(cp.IssueDate)
+	default:
+		return cp.CUSIP
+	}
+	return value + "\x00" + cp.CUSIP
+}
+
+func validPTYSort(field string) bool {
+	for _, f := range ptySortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
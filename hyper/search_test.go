@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ptyCUSIPs(page PTYPage) []string {
+	var cusips []string
+	for _, cp := range page.PTYs {
+		cusips = append(cusips, cp.CUSIP)
+	}
+	return cusips
+}
+
+func TestSearchPTYs(t *testing.T) {
+	l := newTestLedger(t)
+	main1 := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+main1+"','fromCompany':'company1','quantity':10,'sellval':10}")
+	l.invoke("company2", "transferPaper", "{'cusip':'"+main1+"','fromCompany':'company1','toCompany':'company2','quantity':5}")
+
+	// Left pending, with its address in lower case and an issue date in the
+	// payload that the transaction time replaces
+	l.advance(time.Second)
+	issued := l.millis()
+	l.invoke("company1", "issuePropertyToken", "{'name':'2 Elm St','adrStreet':'2 Elm St','adrCity':'dallas','adrPostcode':'75201','adrState':'tx','quantity':100,'issuer':'company1','rent':2000,'mktval':50000,'issueDate':'1'}")
+	elm, err := genHash("2 Elm Stdallas75201tx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cp := l.pty(elm); cp.IssueDate != issued {
+		t.Errorf("issue date is %s, want %s", cp.IssueDate, issued)
+	}
+
+	l.advance(time.Second)
+	l.invoke("admin", "grantRole", "{'id':'company3','role':'issuer'}")
+	l.invoke("admin", "grantRole", "{'id':'company2','role':'valuer'}")
+	main3 := l.issue("company3", "3 Main St", 100)
+	l.invoke("company2", "updateMktVal", "{'cusip':'"+main3+"','mktval':300000}")
+	l.invoke("company3", "setRent", "{'cusip':'"+main3+"','value':1500,'invid':'company3'}")
+
+	// Negative amounts are refused everywhere a property's values are set
+	l.invokeErr("company1", "issuePropertyToken", "{'name':'4 Main St','adrStreet':'4 Main St','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':100,'issuer':'company1','rent':1000,'mktval':-1}")
+	l.invokeErr("company1", "issuePropertyToken", "{'name':'4 Main St','adrStreet':'4 Main St','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':100,'issuer':'company1','rent':-1,'mktval':100000}")
+	l.invokeErr("company2", "updateMktVal", "{'cusip':'"+main3+"','mktval':-1}")
+	l.invokeErr("company3", "setRent", "{'cusip':'"+main3+"','value':-1,'invid':'company3'}")
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"city ignoring case", "{'adrCity':'AUSTIN','sort':'mktval'}", []string{main1, main3}},
+		{"city stored in lower case", "{'adrCity':'Dallas'}", []string{elm}},
+		{"state", "{'adrState':'tx','sort':'name'}", []string{main1, elm, main3}},
+		{"postcode", "{'adrPostcode':'75201'}", []string{elm}},
+		{"issuer", "{'issuer':'company3'}", []string{main3}},
+		{"holder", "{'holder':'company2'}", []string{main1}},
+		{"status", "{'status':'Pending'}", []string{elm}},
+		{"has listings", "{'hasListings':true}", []string{main1}},
+		{"minimum value", "{'minMktval':60000,'sort':'mktval'}", []string{main1, main3}},
+		{"maximum value", "{'maxMktval':100000,'sort':'mktval'}", []string{elm, main1}},
+		{"minimum rent", "{'minRent':1500,'sort':'rent'}", []string{main3, elm}},
+		{"maximum rent", "{'maxRent':1500,'sort':'rent','desc':true}", []string{main3, main1}},
+		{"issuer and city", "{'issuer':'company1','adrCity':'austin'}", []string{main1}},
+		{"by value descending", "{'sort':'mktval','desc':true}", []string{main3, main1, elm}},
+		{"by issue date descending", "{'sort':'issueDate','desc':true}", []string{main3, elm, main1}},
+		{"nothing matches", "{'issuer':'company4'}", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l.t = t
+			var page PTYPage
+			l.queryJSON(&page, "SearchPTYs", tt.query)
+			if got := ptyCUSIPs(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("found %v, want %v", got, tt.want)
+			}
+		})
+	}
+	l.t = t
+
+	// Each page starts after the bookmark, in either direction. Bookmarks
+	// hold a NUL, so they go back JSON encoded
+	for _, desc := range []string{"false", "true"} {
+		want := []string{elm, main1, main3}
+		if desc == "true" {
+			want = []string{main3, main1, elm}
+		}
+		var first, second PTYPage
+		l.queryJSON(&first, "SearchPTYs", "{'sort':'mktval','desc':"+desc+",'limit':2}")
+		if got := ptyCUSIPs(first); !reflect.DeepEqual(got, want[:2]) || first.Bookmark == "" {
+			t.Fatalf("first page with desc %s is %v, bookmark %q", desc, got, first.Bookmark)
+		}
+		bookmark, _ := json.Marshal(first.Bookmark)
+		l.queryJSON(&second, "SearchPTYs", "{'sort':'mktval','desc':"+desc+",'limit':2,'bookmark':"+string(bookmark)+"}")
+		if got := ptyCUSIPs(second); !reflect.DeepEqual(got, want[2:]) || second.Bookmark != "" {
+			t.Errorf("second page with desc %s is %v, bookmark %q", desc, got, second.Bookmark)
+		}
+	}
+
+	_, err = l.stub.MockQuery(l.cc, "query", []string{"SearchPTYs", "{'sort':'owner'}"})
+	if err == nil || !strings.Contains(err.Error(), "can sort by") {
+		t.Errorf("unknown sort refused with %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Lifecycle of a property token. issuePropertyToken creates properties as
+// Pending; nothing can be traded until the property has been approved and
+// then activated.
+const (
+	statusPending   = "Pending"
+	statusApproved  = "Approved"
+	statusActive    = "Active"
+	statusSuspended = "Suspended"
+	statusDelisted  = "Delisted"
+	statusSold      = "Sold"
+)
+
+// statusFrom lists, for each target status, the statuses a property may move
+// to it from.
+var statusFrom = map[string][]string{
+	statusApproved:  {statusPending},
+	statusActive:    {statusApproved, statusSuspended},
+	statusSuspended: {statusApproved, statusActive},
+	statusDelisted:  {statusPending, statusApproved, statusActive, statusSuspended},
+	statusSold:      {statusApproved, statusActive, statusSuspended},
+}
+
+// ChangeStatus is the payload of the status invokes. Approver is optional;
+// the change is always recorded against the calling admin.
+type ChangeStatus struct {
+	CUSIP    string `json:"cusip"`
+	Approver string `json:"invid"`
+	Reason   string `json:"reason"`
+}
+
+func (t *SimpleChaincode) approvePTY(stub StateStub, args []string) ([]byte, error) {
+	return t.changeStatus(stub, args, statusApproved)
+}
+
+// rejectPTY turns down a Pending issuance. A rejected property is delisted
+// straight away; it was never tradable.
+func (t *SimpleChaincode) rejectPTY(stub StateStub, args []string) ([]byte, error) {
+	return t.changeStatus(stub, args, statusDelisted, statusPending)
+}
+
+func (t *SimpleChaincode) activatePTY(stub StateStub, args []string) ([]byte, error) {
+	return t.changeStatus(stub, args, statusActive)
+}
+
+func (t *SimpleChaincode) suspendPTY(stub StateStub, args []string) ([]byte, error) {
+	return t.changeStatus(stub, args, statusSuspended)
+}
+
+func (t *SimpleChaincode) delistPTY(stub StateStub, args []string) ([]byte, error) {
+	return t.changeStatus(stub, args, statusDelisted)
+}
+
+// changeStatus moves a property to status. If from is given it narrows the
+// statuses the move is allowed from.
+func (t *SimpleChaincode) changeStatus(stub StateStub, args []string, status string, from ...string) ([]byte, error) {
+	if len(args) != 1 {
+		fmt.Println("error invalid arguments")
+		return nil, errors.New("Incorrect number of arguments. Expecting status change record")
+	}
+
+	var cs ChangeStatus
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &cs)
+	if err != nil {
+		fmt.Println("error invalid status change")
+		fmt.Println("error: ", err)
+		return nil, errors.New("Invalid status change")
+	}
+
+	approver, err := requireRole(stub, roleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if cs.Approver != "" && cs.Approver != approver.ID {
+		return nil, errors.New("Caller " + approver.ID + " cannot act for " + cs.Approver)
+	}
+	cs.Approver = approver.ID
+
+	cp, err := GetPTY(cs.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == statusApproved && cs.Approver == cp.Issuer {
+		return nil, errors.New("The issuer cannot approve their own property")
+	}
+
+	now, err := txMillis(stub)
+	if err != nil {
+		fmt.Println("Error reading transaction timestamp")
+		return nil, errors.New("Error reading transaction timestamp")
+	}
+
+	err = setStatus(&cp, status, cs.Approver, cs.Reason, now, from...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// setStatus moves cp to status in memory, recording who made the change and
+// why. If from is given it narrows the statuses the move is allowed from.
+func setStatus(cp *PTY, status string, by string, reason string, now string, from ...string) error {
+	if len(from) == 0 {
+		from = statusFrom[status]
+	}
+	if !hasStatus(*cp, from...) {
+		fmt.Println("Cannot move " + cp.CUSIP + " from " + cp.Status + " to " + status)
+		return errors.New("Cannot move property from " + cp.Status + " to " + status)
+	}
+
+	fmt.Println("Moving " + cp.CUSIP + " from " + cp.Status + " to " + status)
+	cp.Status = status
+	cp.StatusBy = by
+	cp.StatusDate = now
+	cp.StatusReason = reason
+	if status == statusApproved {
+		cp.ApprovedBy = by
+		cp.ApprovedDate = now
+	}
+	return nil
+}
+
+func hasStatus(cp PTY, statuses ...string) bool {
+	for _, status := range statuses {
+		if cp.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTradable rejects listing or buying tokens of a property that is not
+// Active.
+func checkTradable(cp PTY) error {
+	if !hasStatus(cp, statusActive) {
+		fmt.Println("Property " + cp.CUSIP + " is " + cp.Status + ", trading is blocked")
+		return errors.New("Property " + cp.CUSIP + " is " + cp.Status + " and cannot be traded")
+	}
+	return nil
+}
+
+// checkRentable rejects rent on a property that is not yet live or has been
+// delisted. A Suspended property has trading halted but still collects rent.
+func checkRentable(cp PTY) error {
+	if !hasStatus(cp, statusActive, statusSuspended) {
+		fmt.Println("Property " + cp.CUSIP + " is " + cp.Status + ", rent is blocked")
+		return errors.New("Property " + cp.CUSIP + " is " + cp.Status + " and cannot collect rent")
+	}
+	return nil
+}
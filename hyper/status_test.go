@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// forceStatus writes cp straight to the ledger with the given status, so a
+// transition can be tried from any starting point.
+func (l *testLedger) forceStatus(cusip string, status string) {
+	l.t.Helper()
+	cp := l.pty(cusip)
+	cp.Status = status
+	cpBytes, err := json.Marshal(&cp)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	l.stub.PutState(ptyPrefix+cusip, cpBytes)
+}
+
+func TestStatusTransitions(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+
+	statuses := []string{statusPending, statusApproved, statusActive, statusSuspended, statusDelisted, statusSold}
+	tests := []struct {
+		function string
+		to       string
+		from     []string
+	}{
+		{"approvePTY", statusApproved, []string{statusPending}},
+		{"rejectPTY", statusDelisted, []string{statusPending}},
+		{"activatePTY", statusActive, []string{statusApproved, statusSuspended}},
+		{"suspendPTY", statusSuspended, []string{statusApproved, statusActive}},
+		{"delistPTY", statusDelisted, []string{statusPending, statusApproved, statusActive, statusSuspended}},
+	}
+	for _, tt := range tests {
+		for _, from := range statuses {
+			t.Run(tt.function+" from "+from, func(t *testing.T) {
+				l.t = t
+				l.forceStatus(cusip, from)
+				allowed := false
+				for _, status := range tt.from {
+					allowed = allowed || status == from
+				}
+				if !allowed {
+					l.invokeErr("admin", tt.function, "{'cusip':'"+cusip+"','reason':'x'}")
+					return
+				}
+				l.invoke("admin", tt.function, "{'cusip':'"+cusip+"','reason':'x'}")
+				if cp := l.pty(cusip); cp.Status != tt.to || cp.StatusBy != "admin" || cp.StatusReason != "x" {
+					t.Errorf("property is %s by %s for %q, want %s by admin", cp.Status, cp.StatusBy, cp.StatusReason, tt.to)
+				}
+			})
+		}
+	}
+}
+
+func TestIssuerCannotApprove(t *testing.T) {
+	l := newTestLedger(t)
+	l.setUp()
+	l.invoke("admin", "grantRole", "{'id':'admin','role':'issuer'}")
+	l.invoke("admin", "issuePropertyToken", "{'name':'2 Main St','adrStreet':'2 Main St','adrCity':'Austin','adrPostcode':'78701','adrState':'TX','quantity':10,'issuer':'admin','rent':1000,'mktval':100000}")
+	cusip, _ := genHash("2 Main St" + "Austin78701TX")
+
+	l.invokeErr("admin", "approvePTY", "{'cusip':'"+cusip+"'}")
+	l.invokeErr("admin", "approvePTY", "{'cusip':'"+cusip+"','invid':'company2'}")
+	l.invoke("admin", "rejectPTY", "{'cusip':'"+cusip+"','reason':'own property'}")
+	if cp := l.pty(cusip); cp.Status != statusDelisted || cp.ApprovedBy != "" {
+		t.Errorf("property is %s approved by %q", cp.Status, cp.ApprovedBy)
+	}
+	l.verify()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// StateStub is the part of the peer's chaincode stub the property chaincode
+// actually uses. Everything below Init/Invoke/Query takes a StateStub rather
+// than the concrete shim type so the logic can be driven by MemStub without
+// a running peer.
+type StateStub interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	DelState(key string) error
+	RangeQueryState(startKey, endKey string) (shim.StateRangeQueryIteratorInterface, error)
+	GetTxID() string
+	GetTxTimestamp() (*timestamp.Timestamp, error)
+	ReadCertAttribute(attributeName string) ([]byte, error)
+}
+
+// txTime is the timestamp of the transaction being executed. Use it instead
+// of time.Now so every peer computes the same result.
+func txTime(stub StateStub) (time.Time, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(ts.Seconds, int64(ts.Nanos)).UTC(), nil
+}
+
+// txMillis is the transaction timestamp in the milliseconds-as-a-string form
+// used by IssueDate.
+func txMillis(stub StateStub) (string, error) {
+	now, err := txTime(stub)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(now.UnixNano()/nanosPerMillisecond, 10), nil
+}
+
+// errStopScan can be returned by a visit function to end a scan early
+// without an error.
+var errStopScan = errors.New("stop scan")
+
+// scanPrefix calls visit for every key that starts with prefix, in key order.
+func scanPrefix(stub StateStub, prefix string, visit func(key string, value []byte) error) error {
+	return scanRange(stub, prefix, prefix+"\xff", visit)
+}
+
+// scanRange calls visit for every key from startKey to endKey inclusive, in
+// key order.
+func scanRange(stub StateStub, startKey string, endKey string, visit func(key string, value []byte) error) error {
+	iter, err := stub.RangeQueryState(startKey, endKey)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	for iter.HasNext() {
+		key, value, err := iter.Next()
+		if err != nil {
+			return err
+		}
+		err = visit(key, value)
+		if err == errStopScan {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compositeKey builds an index key from an object type and attributes, each
+// followed by a NUL byte the way later versions of the shim do. Account IDs
+// and CUSIPs can't contain NUL, so one ID can never be a prefix of another
+// and a scan over compositeKey(type, id) only sees that ID's entries.
+func compositeKey(objectType string, attributes ...string) string {
+	key := objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
+// splitCompositeKey returns the attributes of a key built by compositeKey.
+func splitCompositeKey(key string) []string {
+	parts := strings.Split(key, "\x00")
+	if len(parts) < 2 {
+		return nil
+	}
+	return parts[1 : len(parts)-1]
+}
+
+// newRecordID returns an ID for a record stored under prefix that is unique
+// within the transaction: the transaction ID plus a running number, since one
+// invoke can write several records of the same kind.
+func newRecordID(stub StateStub, prefix string) (string, error) {
+	txID := stub.GetTxID()
+	for n := 1; ; n++ {
+		id := txID + "-" + strconv.Itoa(n)
+		existing, err := stub.GetState(prefix + id)
+		if err != nil {
+			return "", errors.New("Error reading " + prefix + id)
+		}
+		if existing == nil {
+			return id, nil
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var tradePrefix = "trade:"
+
+// Index object types for trades. Each entry's key is
+// (type, cusip or account, padded timestamp, trade ID) and its value is the
+// trade ID.
+const (
+	tradesByCUSIP   = "trade~cusip"
+	tradesByAccount = "trade~acct"
+)
+
+// Trade is the permanent record of one executed transfer. Trades are only
+// ever written once.
+type Trade struct {
+	TradeID   string `json:"tradeId"`
+	CUSIP     string `json:"cusip"`
+	Buyer     string `json:"buyer"`
+	Seller    string `json:"seller"`
+	Quantity  int    `json:"quantity"`
+	Price     Money  `json:"price"`
+	TxID      string `json:"txId"`
+	Timestamp string `json:"timestamp"`
+}
+
+type TradeQuery struct {
+	CUSIP   string `json:"cusip"`
+	Account string `json:"account"`
+	PageQuery
+}
+
+type TradePage struct {
+	Trades   []Trade `json:"trades"`
+	Bookmark string  `json:"bookmark"`
+}
+
+// recordTrade writes a Trade and its CUSIP and account index entries. A
+// single invoke can execute several trades, so the trade ID is the
+// transaction ID plus a running number.
+func recordTrade(stub StateStub, cusip string, seller string, buyer string, quantity int, price Money) (Trade, error) {
+	var trade Trade
+	now, err := txMillis(stub)
+	if err != nil {
+		return trade, errors.New("Error reading transaction timestamp")
+	}
+
+	trade.TradeID, err = newRecordID(stub, tradePrefix)
+	if err != nil {
+		return trade, err
+	}
+
+	trade.CUSIP = cusip
+	trade.Buyer = buyer
+	trade.Seller = seller
+	trade.Quantity = quantity
+	trade.Price = price
+	trade.TxID = stub.GetTxID()
+	trade.Timestamp = now
+
+	tradeBytes, err := json.Marshal(&trade)
+	if err != nil {
+		fmt.Println("Error marshalling trade")
+		return trade, errors.New("Error marshalling trade")
+	}
+	err = stub.PutState(tradePrefix+trade.TradeID, tradeBytes)
+	if err != nil {
+		fmt.Println("Error writing trade")
+		return trade, errors.New("Error writing trade " + trade.TradeID)
+	}
+
+	indexKeys := []string{compositeKey(tradesByCUSIP, cusip, padMillis(now), trade.TradeID)}
+	indexKeys = append(indexKeys, compositeKey(tradesByAccount, buyer, padMillis(now), trade.TradeID))
+	if seller != buyer {
+		indexKeys = append(indexKeys, compositeKey(tradesByAccount, seller, padMillis(now), trade.TradeID))
+	}
+	for _, key := range indexKeys {
+		err = stub.PutState(key, []byte(trade.TradeID))
+		if err != nil {
+			fmt.Println("Error writing trade index")
+			return trade, errors.New("Error writing trade index for " + trade.TradeID)
+		}
+	}
+
+	fmt.Println("Recorded trade " + trade.TradeID)
+	return trade, nil
+}
+
+func GetTrade(tradeID string, stub StateStub) (Trade, error) {
+	var trade Trade
+	tradeBytes, err := stub.GetState(tradePrefix + tradeID)
+	if err != nil || tradeBytes == nil {
+		fmt.Println("Trade not found " + tradeID)
+		return trade, errors.New("Trade not found " + tradeID)
+	}
+	err = json.Unmarshal(tradeBytes, &trade)
+	if err != nil {
+		fmt.Println("Error unmarshalling trade " + tradeID)
+		return trade, errors.New("Error unmarshalling trade " + tradeID)
+	}
+	return trade, nil
+}
+
+// GetTrades pages through a property's trades, oldest first.
+func GetTrades(args string, stub StateStub) (TradePage, error) {
+	var tq TradeQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &tq)
+	if err != nil || tq.CUSIP == "" {
+		return TradePage{}, errors.New("GetTrades expects {\"cusip\": ...}")
+	}
+	return pageTrades(stub, compositeKey(tradesByCUSIP, tq.CUSIP), tq.PageQuery)
+}
+
+// GetAccountTrades pages through the trades an account bought or sold,
+// oldest first.
+func GetAccountTrades(args string, stub StateStub) (TradePage, error) {
+	var tq TradeQuery
+	err := json.Unmarshal([]byte(strings.Replace(args, "'", "\"", -1)), &tq)
+	if err != nil || tq.Account == "" {
+		return TradePage{}, errors.New("GetAccountTrades expects {\"account\": ...}")
+	}
+	return pageTrades(stub, compositeKey(tradesByAccount, tq.Account), tq.PageQuery)
+}
+
+func pageTrades(stub StateStub, prefix string, q PageQuery) (TradePage, error) {
+	var page TradePage
+	bookmark, err := pageIndex(stub, prefix, q, func(key string, value []byte) error {
+		trade, err := GetTrade(string(value), stub)
+		if err != nil {
+			return err
+		}
+		page.Trades = append(page.Trades, trade)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+	page.Bookmark = bookmark
+	return page, nil
+}
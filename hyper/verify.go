@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Invariants checked by verifyState.
+const (
+	checkQuantity = "quantity"
+	checkNegative = "negative"
+	checkHolder   = "holder"
+	checkAssets   = "assets"
+	checkEscrow   = "escrow"
+	checkCash     = "cash"
+	checkRegistry = "registry"
+	checkIndex    = "index"
+)
+
+// Violation is one broken invariant. Key is the state key of the record it
+// was found on.
+type Violation struct {
+	Check  string `json:"check"`
+	Key    string `json:"key"`
+	Detail string `json:"detail"`
+}
+
+// StateReport is the result of verifyState. No invoke creates or destroys
+// cash, so the cash in accounts, in escrow and in property reserves should
+// add up to Expected, the total of the accounts' opening balances.
+// Unrecorded counts accounts opened before opening balances were kept; while
+// there are any the cash check can't be made and is skipped.
+type StateReport struct {
+	Properties int         `json:"properties"`
+	Accounts   int         `json:"accounts"`
+	Unrecorded int         `json:"unrecorded"`
+	Cash       Money       `json:"cash"`
+	Escrow     Money       `json:"escrow"`
+	Reserves   Money       `json:"reserves"`
+	Expected   Money       `json:"expected"`
+	Violations []Violation `json:"violations"`
+}
+
+// verifyState walks every property, account and lease and reports each
+// broken invariant:
+//
+//   - a property's owned plus listed quantities add up to its Qty
+//   - no quantity, price or balance is negative
+//   - a holder has at most one owned entry and one listing per property
+//   - an account's AssetsIds lists exactly the properties it holds
+//   - an account's Escrow is the deposits held on its leases
+//   - the account registry lists exactly the open accounts
+//   - the property indexes hold exactly the entries the properties call for
+//   - the cash on the ledger adds up to what the accounts were opened with,
+//     when every account's opening balance is known
+func verifyState(stub StateStub) (StateReport, error) {
+	var report StateReport
+	holdings := map[string]map[string]bool{}
+	indexed := map[string]bool{}
+
+	err := scanPrefix(stub, ptyPrefix, func(key string, value []byte) error {
+		var cp PTY
+		err := json.Unmarshal(value, &cp)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return errors.New("Error unmarshalling " + key)
+		}
+		report.Properties++
+		report.Violations = append(report.Violations, verifyPTY(key, cp)...)
+		report.Reserves += cp.Reserve
+		for _, indexKey := range ptyIndexKeys(cp) {
+			indexed[indexKey] = true
+		}
+
+		for _, holder := range holdersOf(cp) {
+			if holdings[holder.InvestorID] == nil {
+				holdings[holder.InvestorID] = map[string]bool{}
+			}
+			holdings[holder.InvestorID][cp.CUSIP] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, indexType := range ptyIndexTypes {
+		err = scanPrefix(stub, compositeKey(indexType), func(key string, value []byte) error {
+			if !indexed[key] {
+				report.violate(checkIndex, key, "index entry for "+string(value)+" doesn't match the property")
+			}
+			delete(indexed, key)
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	for key := range indexed {
+		attributes := splitCompositeKey(key)
+		report.violate(checkIndex, key, "property "+attributes[len(attributes)-1]+" has no index entry")
+	}
+
+	escrows := map[string]Money{}
+	err = scanPrefix(stub, leasePrefix, func(key string, value []byte) error {
+		var lease Lease
+		err := json.Unmarshal(value, &lease)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return errors.New("Error unmarshalling " + key)
+		}
+		if lease.Escrow < 0 {
+			report.violate(checkNegative, key, "escrow is "+lease.Escrow.String())
+		}
+		escrows[lease.Tenant] += lease.Escrow
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	registered := map[string]bool{}
+	err = scanPrefix(stub, compositeKey(accountsKey), func(key string, value []byte) error {
+		registered[string(value)] = true
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	err = scanPrefix(stub, accountPrefix, func(key string, value []byte) error {
+		var account Account
+		err := json.Unmarshal(value, &account)
+		if err != nil {
+			fmt.Println("Error unmarshalling " + key)
+			return errors.New("Error unmarshalling " + key)
+		}
+		report.Accounts++
+		if account.Closed == "" && !registered[account.ID] {
+			report.violate(checkRegistry, key, account.ID+" is open but not in the registry")
+		}
+		if account.Closed != "" && registered[account.ID] {
+			report.violate(checkRegistry, key, account.ID+" is closed but still in the registry")
+		}
+		delete(registered, account.ID)
+		report.Cash += account.CashBalance
+		report.Escrow += account.Escrow
+		report.Expected += account.OpeningBalance
+		if account.OpeningBalance == 0 {
+			report.Unrecorded++
+		}
+
+		if account.CashBalance < 0 {
+			report.violate(checkNegative, key, "cash balance is "+account.CashBalance.String())
+		}
+		if account.Escrow != escrows[account.ID] {
+			report.violate(checkEscrow, key, "escrow is "+account.Escrow.String()+" but its leases hold "+escrows[account.ID].String())
+		}
+
+		held := holdings[account.ID]
+		listed := map[string]bool{}
+		for _, cusip := range account.AssetsIds {
+			if listed[cusip] {
+				report.violate(checkAssets, key, cusip+" is in AssetsIds more than once")
+			}
+			listed[cusip] = true
+			if !held[cusip] {
+				report.violate(checkAssets, key, cusip+" is in AssetsIds but not held")
+			}
+		}
+		for cusip := range held {
+			if !listed[cusip] {
+				report.violate(checkAssets, key, cusip+" is held but not in AssetsIds")
+			}
+		}
+		delete(holdings, account.ID)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for id := range registered {
+		report.violate(checkRegistry, compositeKey(accountsKey, id), id+" is in the registry but has no account")
+	}
+	for investorID := range holdings {
+		report.violate(checkHolder, accountPrefix+investorID, investorID+" holds tokens but has no account")
+	}
+
+	total := report.Cash + report.Escrow + report.Reserves
+	if report.Unrecorded > 0 {
+		fmt.Println("verifyState: " + strconv.Itoa(report.Unrecorded) + " accounts have no opening balance, skipping the cash check")
+	} else if total != report.Expected {
+		report.violate(checkCash, accountPrefix, "cash, escrow and reserves total "+total.String()+" but "+strconv.Itoa(report.Accounts)+" accounts were opened with "+report.Expected.String())
+	}
+	return report, nil
+}
+
+// verifyPTY checks the invariants that only need the property itself.
+func verifyPTY(key string, cp PTY) []Violation {
+	var report StateReport
+	if cp.Qty < 0 {
+		report.violate(checkNegative, key, "quantity is "+strconv.Itoa(cp.Qty))
+	}
+	if cp.Reserve < 0 {
+		report.violate(checkNegative, key, "reserve is "+cp.Reserve.String())
+	}
+
+	held := 0
+	owners := map[string]bool{}
+	for _, owner := range cp.Owners {
+		if owner.Quantity < 0 {
+			report.violate(checkNegative, key, owner.InvestorID+" owns "+strconv.Itoa(owner.Quantity))
+		}
+		if owners[owner.InvestorID] {
+			report.violate(checkHolder, key, owner.InvestorID+" has more than one owner entry")
+		}
+		owners[owner.InvestorID] = true
+		held += owner.Quantity
+	}
+
+	sellers := map[string]bool{}
+	for _, forsale := range cp.PT4Sale {
+		if forsale.Quantity < 0 || forsale.SellVal < 0 {
+			report.violate(checkNegative, key, forsale.InvestorID+" lists "+strconv.Itoa(forsale.Quantity)+" at "+forsale.SellVal.String())
+		}
+		if sellers[forsale.InvestorID] {
+			report.violate(checkHolder, key, forsale.InvestorID+" has more than one listing")
+		}
+		sellers[forsale.InvestorID] = true
+		held += forsale.Quantity
+	}
+
+	for _, bid := range cp.Bids {
+		if bid.Quantity < 0 || bid.LimitPrice < 0 {
+			report.violate(checkNegative, key, "bid "+strconv.Itoa(bid.Seq)+" from "+bid.InvestorID+" is for "+strconv.Itoa(bid.Quantity)+" at "+bid.LimitPrice.String())
+		}
+	}
+
+	if held != cp.Qty {
+		report.violate(checkQuantity, key, "owners and listings hold "+strconv.Itoa(held)+" of "+strconv.Itoa(cp.Qty)+" tokens")
+	}
+	return report.Violations
+}
+
+func (r *StateReport) violate(check string, key string, detail string) {
+	fmt.Println("verifyState: " + key + ": " + detail)
+	r.Violations = append(r.Violations, Violation{Check: check, Key: key, Detail: detail})
+}
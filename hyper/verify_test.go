@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// putJSON writes v straight to the ledger under key, bypassing every check
+// the invokes make.
+func (l *testLedger) putJSON(key string, v interface{}) {
+	l.t.Helper()
+	valueBytes, err := json.Marshal(v)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	l.stub.PutState(key, valueBytes)
+}
+
+func TestVerifyState(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(l *testLedger, cusip string)
+		check   string
+	}{
+		{"cash out of nowhere", func(l *testLedger, cusip string) {
+			account := l.account("company2")
+			account.CashBalance += 1
+			l.putJSON(accountPrefix+"company2", account)
+		}, checkCash},
+		{"reserve out of nowhere", func(l *testLedger, cusip string) {
+			cp := l.pty(cusip)
+			cp.Reserve += 100
+			l.putJSON(ptyPrefix+cusip, cp)
+		}, checkCash},
+		{"tokens out of nowhere", func(l *testLedger, cusip string) {
+			cp := l.pty(cusip)
+			cp.Owners[0].Quantity++
+			l.putJSON(ptyPrefix+cusip, cp)
+		}, checkQuantity},
+		{"negative listing", func(l *testLedger, cusip string) {
+			cp := l.pty(cusip)
+			cp.PT4Sale = append(cp.PT4Sale, ForSale{InvestorID: "company1", Quantity: -1, SellVal: 10})
+			cp.Owners[0].Quantity++
+			l.putJSON(ptyPrefix+cusip, cp)
+		}, checkNegative},
+		{"second owner entry", func(l *testLedger, cusip string) {
+			cp := l.pty(cusip)
+			cp.Owners[0].Quantity--
+			cp.Owners = append(cp.Owners, Owner{InvestorID: "company1", Quantity: 1})
+			l.putJSON(ptyPrefix+cusip, cp)
+		}, checkHolder},
+		{"holding missing from AssetsIds", func(l *testLedger, cusip string) {
+			account := l.account("company1")
+			account.AssetsIds = nil
+			l.putJSON(accountPrefix+"company1", account)
+		}, checkAssets},
+		{"escrow without a lease", func(l *testLedger, cusip string) {
+			account := l.account("company4")
+			account.CashBalance--
+			account.Escrow++
+			l.putJSON(accountPrefix+"company4", account)
+		}, checkEscrow},
+		{"unregistered account", func(l *testLedger, cusip string) {
+			l.stub.DelState(compositeKey(accountsKey, "company3"))
+		}, checkRegistry},
+		{"stale index entry", func(l *testLedger, cusip string) {
+			cp := l.pty(cusip)
+			cp.AdrCity = "Dallas"
+			l.putJSON(ptyPrefix+cusip, cp)
+		}, checkIndex},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLedger(t)
+			cusip := l.setUp()
+			l.verify()
+			tt.corrupt(l, cusip)
+
+			var report StateReport
+			l.queryJSON(&report, "verifyState")
+			found := false
+			for _, violation := range report.Violations {
+				found = found || violation.Check == tt.check
+			}
+			if !found {
+				t.Errorf("no %s violation in %+v", tt.check, report.Violations)
+			}
+		})
+	}
+}
+
+func TestVerifyStateOpeningBalances(t *testing.T) {
+	l := newTestLedger(t)
+	l.setUp()
+	var report StateReport
+	l.queryJSON(&report, "verifyState")
+	if report.Accounts != 5 || report.Unrecorded != 0 || report.Expected != defaultCashBalance.MulInt(5) {
+		t.Fatalf("report is %+v", report)
+	}
+
+	// An account from before opening balances were kept, with whatever cash
+	// it had then, turns the cash check off rather than failing it
+	l.putJSON(accountPrefix+"company5", Account{ID: "company5", CashBalance: 12345})
+	l.stub.PutState(compositeKey(accountsKey, "company5"), []byte("company5"))
+	report = StateReport{}
+	l.queryJSON(&report, "verifyState")
+	if report.Accounts != 6 || report.Unrecorded != 1 || len(report.Violations) != 0 {
+		t.Errorf("report is %+v", report)
+	}
+}
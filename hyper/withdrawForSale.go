@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type WithdrawForSale struct {
+	CUSIP       string `json:"cusip"`
+	FromCompany string `json:"fromCompany"`
+	Quantity    int    `json:"quantity"`
+}
+
+// withdrawForSale takes some or all of a holder's listed tokens off the
+// market and hands them back to the holder's Owner entry. It works in any
+// status, so holders can still pull listings from a suspended property.
+func (t *SimpleChaincode) withdrawForSale(stub StateStub, args []string) ([]byte, error) {
+	//   0
+	// json
+	// {
+	//     CUSIP       string   `json:"cusip"`
+	//     FromCompany string   `json:"fromCompany"`
+	//     Quantity    int      `json:"quantity"`
+	// }
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting withdraw record")
+	}
+
+	var wd WithdrawForSale
+	err := json.Unmarshal([]byte(strings.Replace(args[0], "'", "\"", -1)), &wd)
+	if err != nil {
+		fmt.Println("Error Unmarshalling WithdrawForSale")
+		return nil, errors.New("Invalid withdraw record")
+	}
+
+	_, err = requireCaller(stub, wd.FromCompany, roleInvestor, roleIssuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if wd.Quantity <= 0 {
+		return nil, errors.New("Quantity to withdraw must be greater than zero")
+	}
+
+	cp, err := GetPTY(wd.CUSIP, stub)
+	if err != nil {
+		return nil, err
+	}
+
+	listed := -1
+	for key, forsale := range cp.PT4Sale {
+		if forsale.InvestorID == wd.FromCompany {
+			listed = key
+		}
+	}
+	if listed == -1 {
+		fmt.Println("The company " + wd.FromCompany + " has nothing listed for sale")
+		return nil, errors.New("The company " + wd.FromCompany + " has nothing listed for sale")
+	}
+	if cp.PT4Sale[listed].Quantity < wd.Quantity {
+		fmt.Println("The company " + wd.FromCompany + " has not listed that many tokens")
+		return nil, errors.New("The company " + wd.FromCompany + " has not listed that many tokens")
+	}
+
+	fmt.Println("Moving tokens from ForSale back to the owner")
+	cp.PT4Sale[listed].Quantity -= wd.Quantity
+
+	ownerFound := false
+	for key, owner := range cp.Owners {
+		if owner.InvestorID == wd.FromCompany {
+			ownerFound = true
+			cp.Owners[key].Quantity += wd.Quantity
+		}
+	}
+	if ownerFound == false {
+		var owner Owner
+		owner.InvestorID = wd.FromCompany
+		owner.Quantity = wd.Quantity
+		cp.Owners = append(cp.Owners, owner)
+	}
+
+	pruneHoldings(&cp)
+
+	err = putPTY(stub, cp)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Successfully completed Invoke")
+	return nil, nil
+}
+
+// pruneHoldings drops Owner and ForSale entries that are down to zero.
+func pruneHoldings(cp *PTY) {
+	var owners []Owner
+	for _, owner := range cp.Owners {
+		if owner.Quantity != 0 {
+			owners = append(owners, owner)
+		}
+	}
+	cp.Owners = owners
+
+	var listings []ForSale
+	for _, forsale := range cp.PT4Sale {
+		if forsale.Quantity != 0 {
+			listings = append(listings, forsale)
+		}
+	}
+	cp.PT4Sale = listings
+}
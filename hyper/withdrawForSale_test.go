@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestWithdrawForSale(t *testing.T) {
+	l := newTestLedger(t)
+	cusip := l.setUp()
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':40,'sellval':10}")
+
+	l.invokeErr("company2", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':10}")
+	l.invokeErr("company2", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company2','quantity':10}")
+	l.invokeErr("company1", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':0}")
+	l.invokeErr("company1", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':41}")
+
+	l.invoke("company1", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':15}")
+	if owned, listed := holdingOf(l.pty(cusip), "company1"); owned != 75 || listed != 25 {
+		t.Fatalf("after a partial withdrawal company1 holds %d owned and %d listed", owned, listed)
+	}
+
+	l.invoke("company1", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':25}")
+	cp := l.pty(cusip)
+	if owned, listed := holdingOf(cp, "company1"); owned != 100 || listed != 0 || len(cp.PT4Sale) != 0 {
+		t.Fatalf("after a full withdrawal company1 holds %d owned and %d listed, listings are %+v", owned, listed, cp.PT4Sale)
+	}
+	l.invokeErr("company1", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':1}")
+
+	// A holder that listed every token gets them all back in one Owner entry
+	l.invoke("company1", "setForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100,'sellval':10}")
+	l.invoke("company1", "withdrawForSale", "{'cusip':'"+cusip+"','fromCompany':'company1','quantity':100}")
+	cp = l.pty(cusip)
+	if len(cp.Owners) != 1 || cp.Owners[0].Quantity != 100 || len(cp.PT4Sale) != 0 {
+		t.Errorf("after withdrawing everything owners are %+v and listings %+v", cp.Owners, cp.PT4Sale)
+	}
+	l.verify()
+}